@@ -2,14 +2,22 @@ package commands
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/SwayKh/linksym/config"
 	"github.com/SwayKh/linksym/link"
 	"github.com/SwayKh/linksym/logger"
 )
 
+// Options of the add and record subcommands, set with their flags
+type AddOptions struct {
+	Name     string
+	Relative bool
+	Mode     string
+	Tags     []string
+}
+
 // Add function, which handles the Add subcommand and handles all scenarios of
 // file paths provided.
 // Handling one argument is simple enough. But, handling 2 arguments creates
@@ -20,9 +28,7 @@ import (
 // toLink boolean decided whether to perform the Move/Link action or just add
 // record of "linking" to the .linksym.yaml file. Useful for when a symlink
 // already exists, but they record of it doesn't
-// updateRecord bool is used for running the Add function in source subcommand
-// since the Source command doesn't need to update the Records, just Link stuff
-func (app *Application) Add(args []string, toLink bool, updateRecord bool) error {
+func (app *Application) Add(args []string, toLink bool, options AddOptions) error {
 	toMove := true
 
 	switch len(args) {
@@ -39,28 +45,25 @@ func (app *Application) Add(args []string, toLink bool, updateRecord bool) error
 		logger.VerboseLog(logger.SUCCESS, "Source path exists: %s", config.AliasPath(source.AbsPath, app.HomeDirectory, app.InitDirectory, true))
 
 		sourcePath := source.AbsPath
-		filename := filepath.Base(sourcePath)
-		destinationPath := filepath.Join(app.InitDirectory, filename)
+		destinationPath := app.defaultDestination(sourcePath)
 
 		logger.VerboseLog(logger.SUCCESS, "Destination path exists: %s", config.AliasPath(destinationPath, app.HomeDirectory, app.InitDirectory, true))
 
-		paths := link.LinkPaths{
-			SourcePath:      sourcePath,
-			DestinationPath: destinationPath,
-			HomeDir:         app.HomeDirectory,
-			InitDir:         app.InitDirectory,
-			IsDirectory:     source.IsDir,
+		err = app.Configuration.CheckNewRecord(sourcePath, destinationPath, options.Name)
+		if err != nil {
+			return err
 		}
 
+		record := app.newRecord(sourcePath, destinationPath, options)
+		paths := app.linkPaths(sourcePath, destinationPath, source.IsDir)
+
 		if toLink {
-			err = paths.MoveAndLink()
+			err = app.place(record, paths, toMove)
 			if err != nil {
 				return err
 			}
 		}
-		if updateRecord {
-			app.Configuration.AddRecord(sourcePath, destinationPath)
-		}
+		app.Configuration.AddRecord(record)
 
 	case 2:
 		source, err := config.GetFileInfo(args[0])
@@ -101,7 +104,7 @@ func (app *Application) Add(args []string, toLink bool, updateRecord bool) error
 		// on trailling / provided with argument
 		case isSourceFile && !destination.Exists:
 			if destination.HasSlash {
-				err := os.MkdirAll(destinationPath, 0o755)
+				err := link.CreateDirectory(destinationPath, app.HomeDirectory, app.InitDirectory)
 				if err != nil {
 					return err
 				}
@@ -121,7 +124,7 @@ func (app *Application) Add(args []string, toLink bool, updateRecord bool) error
 		// to a File
 		case isSourceDir && !destination.Exists:
 			if destination.HasSlash {
-				err := os.MkdirAll(destinationPath, 0o755)
+				err := link.CreateDirectory(destinationPath, app.HomeDirectory, app.InitDirectory)
 				if err != nil {
 					return err
 				}
@@ -150,27 +153,21 @@ func (app *Application) Add(args []string, toLink bool, updateRecord bool) error
 			return fmt.Errorf("Invalid arguments provided")
 		}
 
-		paths := link.LinkPaths{
-			SourcePath:      sourcePath,
-			DestinationPath: destinationPath,
-			HomeDir:         app.HomeDirectory,
-			InitDir:         app.InitDirectory,
-			IsDirectory:     source.IsDir,
+		err = app.Configuration.CheckNewRecord(sourcePath, destinationPath, options.Name)
+		if err != nil {
+			return err
 		}
 
+		record := app.newRecord(sourcePath, destinationPath, options)
+		paths := app.linkPaths(sourcePath, destinationPath, source.IsDir)
+
 		if toLink {
-			if toMove {
-				err = paths.MoveAndLink()
-			} else {
-				err = paths.Link()
-			}
+			err = app.place(record, paths, toMove)
 			if err != nil {
 				return err
 			}
 		}
-		if updateRecord {
-			app.Configuration.AddRecord(sourcePath, destinationPath)
-		}
+		app.Configuration.AddRecord(record)
 
 	default:
 		return fmt.Errorf("Invalid number of arguments")
@@ -178,6 +175,70 @@ func (app *Application) Add(args []string, toLink bool, updateRecord bool) error
 	return nil
 }
 
+// Put the file of a new record in place. With toMove, the file at the source
+// path is moved into the init directory and linked, or copied there for
+// template and copy records. Otherwise it's already in the init directory, and
+// only linked, rendered or copied. Hardlink records are linked like symlinks
+func (app *Application) place(record config.Record, paths link.LinkPaths, toMove bool) error {
+	paths.Relative = app.Configuration.IsRelative(record)
+	paths.Mode = record.LinkMode()
+	if paths.Mode == config.ModeTemplate {
+		paths.Data = app.templateData()
+	}
+
+	written := paths.Mode == config.ModeTemplate || paths.Mode == config.ModeCopy
+
+	switch {
+	case written && toMove:
+		return paths.CopyToInitDirectory()
+	case written:
+		return paths.Relink()
+	case toMove:
+		return paths.MoveAndLink()
+	default:
+		return paths.Link()
+	}
+}
+
+// Create the record for a new symlink from the options of the add subcommand.
+// The relative setting is only stored in the record if it differs from the
+// setting of the config
+func (app *Application) newRecord(sourcePath, destinationPath string, options AddOptions) config.Record {
+	record := config.Record{
+		Name:  options.Name,
+		Tags:  options.Tags,
+		Paths: []string{sourcePath, destinationPath},
+	}
+
+	// Symlinks are the default, and aren't stored in the record
+	if options.Mode != config.ModeSymlink {
+		record.Mode = options.Mode
+	}
+
+	if options.Relative && !app.Configuration.Relative {
+		record.Relative = &options.Relative
+	}
+	return record
+}
+
+// Get the path in the init directory for a source path, when no destination is
+// provided. With the mirror layout, it's the path relative to the home
+// directory, otherwise the filename directly in the init directory. Paths
+// outside the home directory can't be mirrored, and use the filename
+func (app *Application) defaultDestination(sourcePath string) string {
+	filename := filepath.Base(sourcePath)
+
+	if app.Configuration.Layout == config.LayoutMirror {
+		relativePath, err := filepath.Rel(app.HomeDirectory, sourcePath)
+		if err == nil && !strings.HasPrefix(relativePath, "..") {
+			return filepath.Join(app.InitDirectory, relativePath)
+		}
+		logger.Log(logger.WARNING, "%s is outside the home directory, adding it as %s", sourcePath, filename)
+	}
+
+	return filepath.Join(app.InitDirectory, filename)
+}
+
 // Append filename from Source path to Destination path
 func appendToDestinationPath(sourcePath, destinationPath string) string {
 	filename := filepath.Base(sourcePath)
@@ -0,0 +1,406 @@
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/flags"
+)
+
+// How a command uses the config file, which decides how much of Run() happens
+// before the command runs
+type configAccess int
+
+const (
+	// The config is changed, under the journal, and written back
+	configWrite configAccess = iota
+	// The config is loaded, but nothing is written back
+	configRead
+	// The config is loaded, and the journal of an interrupted run is replayed
+	// or reverted, which needs the lock even though nothing is written back
+	configRecover
+	// The config file is only read as it is, without loading it
+	configRaw
+	// The command runs before any config exists
+	configNone
+	// The command doesn't use the config of linksym at all
+	configUnused
+)
+
+// A subcommand of linksym. Every command has its own flags, which are parsed
+// along with the global flags anywhere on the command line, and its arguments
+// are checked against Args before it runs. Help and completion are generated
+// from the same table
+type Command struct {
+	Name string
+	// Arguments after the flags, like "<record(s)...>"
+	Args    string
+	Summary string
+	// Number of arguments accepted. MaxArgs is -1 for any number
+	MinArgs int
+	MaxArgs int
+	access  configAccess
+	// Hidden commands aren't listed in help
+	Hidden bool
+	// Shown in the help of the command and its man page
+	Examples []Example
+	// When the command exits with status 1, for commands that fail for more
+	// than errors
+	Failure string
+	// Commands whose changes are committed to git with --commit, or the
+	// auto_commit field in the config
+	commits bool
+
+	// Define the flags of the command on the FlagSet, and return the function
+	// running it, which reads the values of the flags
+	Setup func(flagSet *flag.FlagSet) func(app *Application, args []string) error
+	// Values the argument after args can be completed with, from the loaded
+	// config. Arguments of commands without it are completed as file paths
+	Complete func(app *Application, args []string) []string
+}
+
+// An example invocation of a command
+type Example struct {
+	Description string
+	Command     string
+}
+
+// Every subcommand, in the order they are listed in help
+var Commands = []*Command{
+	{
+		Name:    "init",
+		Summary: "Initialize the linksym configuration file (.linksym.yaml) to hold records of symlinks.",
+		access:  configNone,
+		Examples: []Example{
+			{"Start tracking the dotfiles in ~/dotfiles", "cd ~/dotfiles && linksym init"},
+		},
+		Setup: func(*flag.FlagSet) func(*Application, []string) error {
+			return func(app *Application, args []string) error { return app.Init() }
+		},
+	},
+	{
+		Name:    "add",
+		Args:    "<source> [destination]",
+		Summary: "Create a symlink for the specified path. Optionally takes a destination path for the symlink. With --mode template, copy or hardlink, the file is rendered, copied or hardlinked instead.",
+		MinArgs: 1,
+		MaxArgs: 2,
+		commits: true,
+		Examples: []Example{
+			{"Move ~/.vimrc into the current dotfiles directory and link it back", "linksym add ~/.vimrc"},
+			{"Add the Neovim config with a name and tags", "linksym add --name nvim --tag editor ~/.config/nvim"},
+			{"Add a file and commit it with git", "linksym add --commit ~/.gitconfig"},
+			{"Keep a copy of a file that must not be a symlink", "linksym add --mode copy ~/.config/app/settings.json"},
+		},
+		Setup: addSetup(true),
+	},
+	{
+		Name:    "record",
+		Args:    "<source> [destination]",
+		Summary: "Creates a record of a symlink in .linksym.yaml, without actually creating the symlink.",
+		MinArgs: 1,
+		MaxArgs: 2,
+		commits: true,
+		Examples: []Example{
+			{"Record a symlink that already exists", "linksym record ~/.vimrc ~/dotfiles/.vimrc"},
+		},
+		Setup: addSetup(false),
+	},
+	{
+		Name:    "remove",
+		Args:    "<record(s)...>",
+		Summary: "Remove the symlink and restore the original file to its original path.",
+		MinArgs: 1,
+		MaxArgs: -1,
+		commits: true,
+		Examples: []Example{
+			{"Restore ~/.vimrc and forget its record", "linksym remove ~/.vimrc"},
+			{"Remove two records by their names", "linksym remove nvim tmux"},
+		},
+		Setup: func(*flag.FlagSet) func(*Application, []string) error {
+			return (*Application).Remove
+		},
+		Complete: (*Application).recordCompletions,
+	},
+	{
+		Name:    "source",
+		Summary: "Create all symlinks described in the .linksym.yaml configuration file, skipping records whose conditions don't match.",
+		Examples: []Example{
+			{"Link every record on a new machine", "linksym source"},
+			{"Show what would be linked for another host", "linksym --dry-run --host laptop source"},
+		},
+		Setup: func(*flag.FlagSet) func(*Application, []string) error {
+			return func(app *Application, args []string) error { return app.Source() }
+		},
+	},
+	{
+		Name:    "update",
+		Summary: "Update the init directory in .linksym.yaml to the directory it's in.",
+		commits: true,
+		Examples: []Example{
+			{"Update the config after moving the dotfiles directory", "mv ~/dots ~/dotfiles && linksym -C ~/dotfiles update"},
+		},
+		Setup: func(*flag.FlagSet) func(*Application, []string) error {
+			return func(app *Application, args []string) error { return app.Update() }
+		},
+	},
+	{
+		Name:    "reorganize",
+		Summary: "Move the files in the init directory to the mirror layout and retarget their symlinks.",
+		Examples: []Example{
+			{"Preview moving the files to the mirror layout", "linksym --dry-run reorganize"},
+		},
+		Setup: func(*flag.FlagSet) func(*Application, []string) error {
+			return func(app *Application, args []string) error { return app.Reorganize() }
+		},
+	},
+	{
+		Name:    "convert",
+		Args:    "<relative|absolute> [record(s)...]",
+		Summary: "Replace the symlinks of records with relative or absolute symlinks.",
+		MinArgs: 1,
+		MaxArgs: -1,
+		Examples: []Example{
+			{"Use relative symlinks for every record", "linksym convert relative"},
+			{"Use an absolute symlink for one record", "linksym convert absolute nvim"},
+		},
+		Setup: func(*flag.FlagSet) func(*Application, []string) error {
+			return (*Application).Convert
+		},
+		Complete: func(app *Application, args []string) []string {
+			if len(args) == 0 {
+				return []string{"relative", "absolute"}
+			}
+			return app.recordCompletions(args)
+		},
+	},
+	{
+		Name:    "pull",
+		Args:    "[record(s)...]",
+		Summary: "Copy edited files of copy records back into the init directory.",
+		MaxArgs: -1,
+		Examples: []Example{
+			{"Copy back every edited copy", "linksym pull"},
+		},
+		Setup: func(*flag.FlagSet) func(*Application, []string) error {
+			return (*Application).Pull
+		},
+		Complete: (*Application).recordCompletions,
+	},
+	{
+		Name:    "status",
+		Args:    "[record(s)...]",
+		Summary: "Check every record in .linksym.yaml and report whether its symlink is in place.",
+		MaxArgs: -1,
+		access:  configRead,
+		Failure: "A record isn't linked correctly, or the records couldn't be checked.",
+		Examples: []Example{
+			{"Check every record", "linksym status"},
+			{"Check records in a script", "linksym --output json status > status.json"},
+			{"Show which files have changes that aren't committed", "linksym status --git"},
+		},
+		Setup: func(flagSet *flag.FlagSet) func(*Application, []string) error {
+			options := StatusOptions{}
+			flagSet.BoolVar(&options.Git, "git", false, "Show the git state of the file of each record: clean, modified, untracked or ignored")
+			return func(app *Application, args []string) error {
+				return app.Status(args, options)
+			}
+		},
+		Complete: (*Application).recordCompletions,
+	},
+	{
+		Name:    "list",
+		Summary: "List the records in .linksym.yaml as a table with their state, filtered, sorted or formatted with a Go template.",
+		access:  configRead,
+		Examples: []Example{
+			{"List the records tagged shell, by name", "linksym list --tag shell --sort name"},
+			{"Print the symlink path of every broken record", `linksym list --state symlink_missing --format '{{.Source}}'`},
+		},
+		Setup: listSetup,
+	},
+	{
+		Name:    "validate",
+		Summary: "Check .linksym.yaml and report every problem with its line and column. Exits with an error if any problem is an error.",
+		access:  configRaw,
+		Failure: "The config has an error, or couldn't be read.",
+		Examples: []Example{
+			{"Check the config before committing it", "linksym validate"},
+		},
+		Setup: func(*flag.FlagSet) func(*Application, []string) error {
+			return func(app *Application, args []string) error { return app.Validate() }
+		},
+	},
+	{
+		Name:    "recover",
+		Args:    "[replay|revert]",
+		Summary: "Show, finish or undo the changes of a linksym run that was interrupted.",
+		MaxArgs: 1,
+		access:  configRecover,
+		Examples: []Example{
+			{"Show what an interrupted run did", "linksym recover"},
+			{"Undo everything the interrupted run did", "linksym recover revert"},
+		},
+		Setup: func(*flag.FlagSet) func(*Application, []string) error {
+			return (*Application).Recover
+		},
+		Complete: func(app *Application, args []string) []string {
+			if len(args) == 0 {
+				return []string{"replay", "revert"}
+			}
+			return []string{}
+		},
+	},
+}
+
+// Define the flags of the add and record subcommands
+func addSetup(toLink bool) func(*flag.FlagSet) func(*Application, []string) error {
+	return func(flagSet *flag.FlagSet) func(*Application, []string) error {
+		options := AddOptions{}
+		flagSet.StringVar(&options.Name, "name", "", "Name of the record")
+		flagSet.BoolVar(&options.Relative, "relative", false, "Create a relative symlink")
+		flagSet.StringVar(&options.Mode, "mode", config.ModeSymlink, "How the record is put in place: symlink, template, copy or hardlink")
+		template := flagSet.Bool("template", false, "Add the file as a template, same as --mode template")
+		flagSet.Var((*stringList)(&options.Tags), "tag", "Tag the record, can be given more than once")
+
+		return func(app *Application, args []string) error {
+			if *template {
+				options.Mode = config.ModeTemplate
+			}
+			err := config.ValidateMode(options.Mode)
+			if err != nil {
+				return err
+			}
+			// The record subcommand only records the symlink, without moving or
+			// linking anything
+			return app.Add(args, toLink, options)
+		}
+	}
+}
+
+// Get the command with the given name, or nil if there's none
+func FindCommand(name string) *Command {
+	for _, command := range Commands {
+		if command.Name == name {
+			return command
+		}
+	}
+	return nil
+}
+
+// Create the FlagSet of the command with only its own flags, and the function
+// running it
+func (c *Command) FlagSet() (*flag.FlagSet, func(app *Application, args []string) error) {
+	flagSet := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	flagSet.SetOutput(io.Discard)
+	flagSet.Usage = func() {}
+	run := c.Setup(flagSet)
+
+	if c.commits {
+		commit := flagSet.Bool("commit", false, "Commit the changes with git, like the auto_commit field in .linksym.yaml")
+		setupRun := run
+		run = func(app *Application, args []string) error {
+			app.Commit = *commit
+			return setupRun(app, args)
+		}
+	}
+	return flagSet, run
+}
+
+// Usage line of the command, with its flags and arguments
+func (c *Command) Usage() string {
+	flagSet, _ := c.FlagSet()
+
+	parts := []string{c.Name}
+	flagSet.VisitAll(func(f *flag.Flag) {
+		// Flags without a `name` in their usage are shown with their own name
+		name, _ := flag.UnquoteUsage(f)
+		if name == "string" || name == "value" {
+			name = f.Name
+		}
+		if isBoolFlag(f) {
+			parts = append(parts, fmt.Sprintf("[--%s]", f.Name))
+		} else {
+			parts = append(parts, fmt.Sprintf("[--%s <%s>]", f.Name, name))
+		}
+	})
+	if c.Args != "" {
+		parts = append(parts, c.Args)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Parse the flags and arguments of the command. Flags can come before, after
+// or between the arguments, and every argument after -- is taken as it is.
+// The global flags are accepted too
+func (c *Command) Parse(args []string) ([]string, func(app *Application, args []string) error, error) {
+	flagSet, run := c.FlagSet()
+	flags.CreateFlags(flagSet)
+
+	positional := []string{}
+	for {
+		err := flagSet.Parse(args)
+		if err != nil {
+			return nil, nil, c.usageError(err.Error())
+		}
+
+		// The flag package stops at the first argument, and at --, after
+		// which everything is an argument
+		rest := flagSet.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+
+	if *flags.HelpFlag {
+		return positional, run, nil
+	}
+
+	switch {
+	case len(positional) < c.MinArgs && c.MinArgs == 1:
+		return nil, nil, c.usageError(fmt.Sprintf("'%s' subcommand needs at least 1 argument", c.Name))
+	case len(positional) < c.MinArgs:
+		return nil, nil, c.usageError(fmt.Sprintf("'%s' subcommand needs at least %d arguments", c.Name, c.MinArgs))
+	case c.MaxArgs == 0 && len(positional) > 0:
+		return nil, nil, c.usageError(fmt.Sprintf("'%s' subcommand doesn't accept any arguments", c.Name))
+	case c.MaxArgs == 1 && len(positional) > 1:
+		return nil, nil, c.usageError(fmt.Sprintf("'%s' subcommand doesn't accept more than 1 argument", c.Name))
+	case c.MaxArgs > 0 && len(positional) > c.MaxArgs:
+		return nil, nil, c.usageError(fmt.Sprintf("'%s' subcommand doesn't accept more than %d arguments", c.Name, c.MaxArgs))
+	}
+	return positional, run, nil
+}
+
+var ErrUsage = errors.New("Usage")
+
+func (c *Command) usageError(message string) error {
+	return fmt.Errorf("%s.\n%w: linksym %s", message, ErrUsage, c.Usage())
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && boolFlag.IsBoolFlag()
+}
+
+// Flag that can be given more than once, collecting every value
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -0,0 +1,321 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/flags"
+	"github.com/SwayKh/linksym/link"
+	"github.com/SwayKh/linksym/logger"
+)
+
+// Printed by __complete when the shell should complete file paths itself
+const completeFiles = ":files"
+
+// Completion scripts of every supported shell. Each calls linksym __complete
+// with the words of the command line, the last one being the word that's
+// completed, and offers the lines it prints
+var completionScripts = map[string]string{
+	"bash": `# bash completion for linksym
+# Add to ~/.bashrc: source <(linksym completion bash)
+_linksym() {
+	local IFS=$'\n'
+	local candidates
+	candidates=($(linksym __complete -- "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+	if [[ ${candidates[0]} == "` + completeFiles + `" ]]; then
+		compopt -o default
+		COMPREPLY=()
+		return
+	fi
+	COMPREPLY=("${candidates[@]}")
+}
+complete -F _linksym linksym
+`,
+	"zsh": `#compdef linksym
+# zsh completion for linksym
+# Add to ~/.zshrc, after compinit: source <(linksym completion zsh)
+_linksym() {
+	local -a candidates
+	candidates=(${(f)"$(linksym __complete -- "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+	if [[ ${candidates[1]} == "` + completeFiles + `" ]]; then
+		_files
+		return
+	fi
+	compadd -Q -- "${candidates[@]}"
+}
+
+if [[ ${funcstack[1]} == "_linksym" ]]; then
+	_linksym "$@"
+else
+	compdef _linksym linksym
+fi
+`,
+	"fish": `# fish completion for linksym
+# Add to ~/.config/fish/config.fish: linksym completion fish | source
+function __linksym_complete
+	set -l words (commandline -opc)
+	set -l current (commandline -ct)
+	set -l candidates (linksym __complete -- $words[2..-1] "$current" 2>/dev/null)
+	if test "$candidates[1]" = "` + completeFiles + `"
+		__fish_complete_path "$current"
+		return
+	end
+	printf '%s\n' $candidates
+end
+
+complete -c linksym -f -a '(__linksym_complete)'
+`,
+}
+
+// Values of flags that can be completed, by the name of the flag. Other flags
+// are completed as file paths
+var flagCompletions = map[string]func(app *Application) []string{
+	"mode": func(*Application) []string {
+		return []string{config.ModeSymlink, config.ModeTemplate, config.ModeCopy, config.ModeHardlink}
+	},
+	"on-conflict": func(*Application) []string {
+		return []string{string(link.ConflictFail), string(link.ConflictBackup), string(link.ConflictOverwrite), string(link.ConflictPrompt)}
+	},
+	"output": func(*Application) []string {
+		return []string{logger.OutputText, logger.OutputJSON}
+	},
+	"sort": func(*Application) []string {
+		sorts := []string{}
+		for sort := range listSorts {
+			sorts = append(sorts, sort)
+		}
+		slices.Sort(sorts)
+		return sorts
+	},
+	"state": func(*Application) []string {
+		states := []string{}
+		for state := link.StateLinked; state <= link.StateModified; state++ {
+			states = append(states, state.Name())
+		}
+		return append(states, "skipped", "invalid")
+	},
+	"tag":  (*Application).tagCompletions,
+	"name": func(*Application) []string { return []string{} },
+}
+
+// The completion commands read the command table, so they are added to it here
+// instead of in its definition, which would be an initialization cycle
+func init() {
+	Commands = append(Commands,
+		&Command{
+			Name:    "completion",
+			Args:    "<bash|zsh|fish>",
+			Summary: "Print the shell completion script for bash, zsh or fish, which completes subcommands, flags and record names.",
+			MinArgs: 1,
+			MaxArgs: 1,
+			access:  configUnused,
+			Examples: []Example{
+				{"Complete linksym in every new bash shell", "echo 'source <(linksym completion bash)' >> ~/.bashrc"},
+				{"Install the fish completion", "linksym completion fish > ~/.config/fish/completions/linksym.fish"},
+			},
+			Setup: func(*flag.FlagSet) func(*Application, []string) error {
+				return (*Application).Completion
+			},
+			Complete: func(app *Application, args []string) []string {
+				if len(args) == 0 {
+					return []string{"bash", "fish", "zsh"}
+				}
+				return []string{}
+			},
+		},
+		&Command{
+			Name:    "__complete",
+			Args:    "[words...]",
+			Summary: "Print the completions of the last word of a linksym command line, used by the completion scripts.",
+			MaxArgs: -1,
+			access:  configUnused,
+			Hidden:  true,
+			Setup: func(*flag.FlagSet) func(*Application, []string) error {
+				return (*Application).Complete
+			},
+		},
+	)
+}
+
+// Print the completion script of a shell
+func (app *Application) Completion(args []string) error {
+	script, ok := completionScripts[args[0]]
+	if !ok {
+		return fmt.Errorf("Invalid shell %q. Valid shells are bash, zsh and fish", args[0])
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// Print the completions of the last of the words, one per line. The words are
+// the command line after linksym, and the config is only loaded if record
+// names or tags are completed. Errors are never reported, since they would
+// end up in the middle of the command line
+func (app *Application) Complete(args []string) error {
+	// Only the completions are printed, so the shell never offers a log
+	// message as one
+	logger.Silence()
+
+	if len(args) == 0 {
+		return nil
+	}
+	current := args[len(args)-1]
+
+	var command *Command
+	flagSet := completionFlags(nil)
+	var flagValue *flag.Flag
+	positional := []string{}
+	afterDashes := false
+
+	for _, word := range args[:len(args)-1] {
+		switch {
+		case flagValue != nil:
+			if flagValue.Name == "C" || flagValue.Name == "config" {
+				*flags.ConfigFlag = word
+			}
+			flagValue = nil
+		case !afterDashes && word == "--" && command != nil:
+			afterDashes = true
+		case !afterDashes && strings.HasPrefix(word, "-") && len(word) > 1:
+			name, value, hasValue := strings.Cut(strings.TrimLeft(word, "-"), "=")
+			f := flagSet.Lookup(name)
+			if f == nil || isBoolFlag(f) {
+				continue
+			}
+			if !hasValue {
+				flagValue = f
+			} else if name == "C" || name == "config" {
+				*flags.ConfigFlag = value
+			}
+		case command == nil:
+			command = FindCommand(word)
+			if command == nil {
+				return nil
+			}
+			flagSet = completionFlags(command)
+		default:
+			positional = append(positional, word)
+		}
+	}
+
+	var candidates []string
+	switch {
+	case flagValue != nil:
+		if complete, ok := flagCompletions[flagValue.Name]; ok {
+			candidates = complete(app)
+		}
+	case !afterDashes && strings.HasPrefix(current, "-"):
+		candidates = []string{}
+		flagSet.VisitAll(func(f *flag.Flag) {
+			if len(f.Name) == 1 {
+				candidates = append(candidates, "-"+f.Name)
+			} else {
+				candidates = append(candidates, "--"+f.Name)
+			}
+		})
+	case command == nil:
+		candidates = []string{}
+		for _, command := range Commands {
+			if !command.Hidden {
+				candidates = append(candidates, command.Name)
+			}
+		}
+	case command.Complete != nil:
+		candidates = command.Complete(app, positional)
+	}
+
+	if candidates == nil {
+		fmt.Println(completeFiles)
+		return nil
+	}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, current) {
+			fmt.Println(candidate)
+		}
+	}
+	return nil
+}
+
+// FlagSet with the global flags, and the flags of the command if there's one.
+// The flags are only looked up, never parsed
+func completionFlags(command *Command) *flag.FlagSet {
+	flagSet := flag.NewFlagSet("linksym", flag.ContinueOnError)
+	if command != nil {
+		flagSet, _ = command.FlagSet()
+	}
+	flags.CreateFlags(flagSet)
+	return flagSet
+}
+
+// Load the config for completion, without the lock. The config is only read,
+// and never migrated on disk. Returns false if there's no usable config
+func (app *Application) loadCompletionConfig() bool {
+	if app.Configuration != nil {
+		return true
+	}
+
+	configPath, err := config.FindConfig(app.ConfigName, *flags.ConfigFlag)
+	if err != nil {
+		return false
+	}
+	configuration, err := config.ReadConfig(configPath)
+	if err != nil {
+		return false
+	}
+
+	app.ConfigPath = configPath
+	app.InitDirectory = config.ExpandPath(configuration.InitDirectory, app.HomeDirectory, configuration.InitDirectory)
+	configuration.UnAliasConfig(app.HomeDirectory, app.InitDirectory)
+	app.Configuration = configuration
+	return true
+}
+
+// Complete the names of records, and the paths of their symlinks. Paths are
+// offered starting with ~, like in the config, and relative to the current
+// directory if they are in it. Records already given aren't offered again
+func (app *Application) recordCompletions(args []string) []string {
+	candidates := []string{}
+	if !app.loadCompletionConfig() {
+		return candidates
+	}
+	cwd, _ := os.Getwd()
+
+	for _, record := range app.Configuration.Records {
+		if slices.Contains(args, record.Label()) || slices.Contains(args, record.ID) {
+			continue
+		}
+		candidates = append(candidates, record.Label())
+		if len(record.Paths) == 0 {
+			continue
+		}
+
+		source := record.Paths[0]
+		candidates = append(candidates, config.AliasPath(source, app.HomeDirectory, app.InitDirectory, true))
+		if relPath, err := filepath.Rel(cwd, source); err == nil && !strings.HasPrefix(relPath, "..") {
+			candidates = append(candidates, relPath)
+		}
+	}
+	return candidates
+}
+
+// Complete the tags used by any record
+func (app *Application) tagCompletions() []string {
+	tags := []string{}
+	if !app.loadCompletionConfig() {
+		return tags
+	}
+	for _, record := range app.Configuration.Records {
+		for _, tag := range record.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	slices.Sort(tags)
+	return tags
+}
@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/link"
+	"github.com/SwayKh/linksym/logger"
+)
+
+// Switch the symlinks of every record, or only the records matching the
+// arguments, between absolute and relative symlinks, and store the setting in
+// the records. Records whose symlink isn't in place only have their setting
+// changed, and get the new kind of symlink the next time they are sourced
+func (app *Application) Convert(args []string) error {
+	if len(args) == 0 || (args[0] != "relative" && args[0] != "absolute") {
+		return fmt.Errorf("'convert' subcommand needs relative or absolute as its first argument.\nUsage: linksym convert <relative|absolute> [record(s)...]")
+	}
+	relative := args[0] == "relative"
+
+	records, err := app.findRecords(args[1:])
+	if err != nil {
+		return err
+	}
+
+	converted := 0
+	for _, found := range records {
+		record := app.Configuration.RecordByID(found.ID)
+
+		if record.LinkMode() != config.ModeSymlink {
+			logger.Log(logger.WARNING, "%s is a %s record, it has no symlink to convert", record.Label(), record.LinkMode())
+			continue
+		}
+
+		// The setting is only kept in the record if it differs from the config
+		record.Relative = nil
+		if relative != app.Configuration.Relative {
+			record.Relative = &relative
+		}
+
+		paths, err := app.recordPaths(*record)
+		if err != nil {
+			return err
+		}
+
+		state, err := paths.State()
+		if err != nil {
+			return err
+		}
+
+		if state != link.StateLinked {
+			logger.Log(logger.WARNING, "%s is %s, only updating its record", config.AliasPath(paths.SourcePath, app.HomeDirectory, app.InitDirectory, true), state)
+			continue
+		}
+
+		err = paths.Recreate()
+		if err != nil {
+			return err
+		}
+		converted++
+	}
+
+	logger.Log(logger.SUCCESS, "Converted %d records to %s symlinks", converted, args[0])
+	return nil
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/flags"
+	"github.com/SwayKh/linksym/git"
+	"github.com/SwayKh/linksym/logger"
+)
+
+// Files changed by a command, and the message they are committed with
+type gitChanges struct {
+	paths   []string
+	message string
+}
+
+// Copy the records, with their own paths, so they can be compared with the
+// records after the command ran
+func cloneRecords(records []config.Record) []config.Record {
+	clone := slices.Clone(records)
+	for i := range clone {
+		clone[i].Paths = slices.Clone(clone[i].Paths)
+	}
+	return clone
+}
+
+// Find the files in the init directory of the records the command added or
+// removed, comparing them with the records before it ran. The config is always
+// committed, and the message names the command and the records
+func (app *Application) gitChanges(command string, before []config.Record) gitChanges {
+	changes := gitChanges{paths: []string{app.ConfigPath}}
+	labels := []string{}
+
+	ids := map[string]bool{}
+	for _, record := range before {
+		ids[record.ID] = true
+	}
+	for _, record := range app.Configuration.Records {
+		if ids[record.ID] {
+			delete(ids, record.ID)
+			continue
+		}
+		labels = append(labels, record.Label())
+		if len(record.Paths) == 2 {
+			changes.paths = append(changes.paths, record.Paths[1])
+		}
+	}
+	// The IDs left are of the records that were removed
+	for _, record := range before {
+		if !ids[record.ID] {
+			continue
+		}
+		labels = append(labels, record.Label())
+		if len(record.Paths) == 2 {
+			changes.paths = append(changes.paths, record.Paths[1])
+		}
+	}
+
+	if len(labels) > 0 {
+		changes.message = fmt.Sprintf("linksym %s: %s", command, strings.Join(labels, ", "))
+	} else {
+		changes.message = fmt.Sprintf("linksym %s", command)
+	}
+	return changes
+}
+
+// Commit the changes of the command. The command already succeeded, so a
+// failed commit is only a warning, and the files are left for the user to
+// commit
+func (app *Application) commitChanges(changes gitChanges) {
+	if *flags.DryRunFlag {
+		logger.Log(logger.INFO, "Would commit %q", changes.message)
+		return
+	}
+
+	committed, err := git.Commit(app.InitDirectory, changes.paths, changes.message)
+	if err != nil {
+		logger.Log(logger.WARNING, "Changes weren't committed: %v", err)
+		return
+	}
+	if !committed {
+		logger.VerboseLog(logger.INFO, "Nothing to commit")
+		return
+	}
+
+	logger.Emit(logger.ActionEvent{Action: "commit", Path: app.InitDirectory})
+	logger.Log(logger.SUCCESS, "Committed %q", changes.message)
+}
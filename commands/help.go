@@ -1,40 +1,209 @@
 package commands
 
 import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/SwayKh/linksym/flags"
+	"github.com/SwayKh/linksym/logger"
 	"github.com/fatih/color"
 )
 
+// A flag as it's listed in help and the man page, with all of its names
+type flagHelp struct {
+	Flags string
+	Usage string
+}
+
+// The global flags, as flags.CreateFlags defines them on every FlagSet
+func globalFlagsHelp() []flagHelp {
+	flagSet := flag.NewFlagSet("linksym", flag.ContinueOnError)
+	flags.CreateFlags(flagSet)
+	return flagSetHelp(flagSet)
+}
+
+// The help command prints the help of other commands, so it's added to the
+// command table here instead of in its definition
+func init() {
+	Commands = append(Commands, &Command{
+		Name:    "help",
+		Args:    "[command]",
+		Summary: "Show the help of a command, with its flags, examples and exit codes, or this help message.",
+		MaxArgs: 1,
+		access:  configUnused,
+		Examples: []Example{
+			{"Show the flags of the add command", "linksym help add"},
+		},
+		Setup: func(*flag.FlagSet) func(*Application, []string) error {
+			return func(app *Application, args []string) error {
+				if len(args) == 0 {
+					Help()
+					return nil
+				}
+				command := FindCommand(args[0])
+				if command == nil {
+					return fmt.Errorf("Unknown command %q. Please use -h or --help flags to see available commands.", args[0])
+				}
+				command.PrintUsage()
+				return nil
+			}
+		},
+		Complete: func(app *Application, args []string) []string {
+			names := []string{}
+			if len(args) == 0 {
+				for _, command := range Commands {
+					if !command.Hidden {
+						names = append(names, command.Name)
+					}
+				}
+			}
+			return names
+		},
+	})
+}
+
+// Get the functions printing the lines of help in each of its styles. Help is
+// written to stdout, unless the output is JSON, where stdout only has the JSON
+// events and help goes to stderr
+func helpPrinters() (white, boldWhite, underlineBoldWhite func(...any)) {
+	var w io.Writer = color.Output
+	if logger.JSONOutput() {
+		w = os.Stderr
+	}
+	printer := func(attributes ...color.Attribute) func(...any) {
+		fprintln := color.New(attributes...).FprintlnFunc()
+		return func(a ...any) { fprintln(w, a...) }
+	}
+	return printer(color.FgWhite), printer(color.FgWhite, color.Bold), printer(color.FgWhite, color.Bold, color.Underline)
+}
+
 func Help() {
-	white := color.New(color.FgWhite).PrintlnFunc()
-	boldWhite := color.New(color.FgWhite, color.Bold).PrintlnFunc()
-	underlineBoldWhite := color.New(color.FgWhite, color.Bold, color.Underline).PrintlnFunc()
+	white, boldWhite, underlineBoldWhite := helpPrinters()
 
 	underlineBoldWhite("USAGE:")
 	boldWhite("  linksym [flags] [subcommand]")
 	white()
 	underlineBoldWhite("FLAGS:")
-	boldWhite("  -h, --help")
-	white("    Display this help message.")
-	boldWhite("  -v")
-	white("    Show verbose output.")
+	for _, f := range globalFlagsHelp() {
+		boldWhite("  " + f.Flags)
+		white("    " + f.Usage)
+	}
 	white()
 	underlineBoldWhite("AVAILABLE COMMANDS:")
-	boldWhite("  init")
-	white("    Initialize the linksym configuration file (.linksym.yaml) to hold records of symlinks.")
-	white()
-	boldWhite("  add [target] [destination (Optional)]")
-	white("    Create a symlink for the specified path. Optionally takes a destination path for the symlink.")
-	white()
-	boldWhite("  record [target] [destination (Optional)]")
-	white("    Creates a record of symlink in .linksym.yaml, which actually creating symlink.")
-	white()
-	boldWhite("  remove [target(s)...]")
-	white("    Remove the symlink and restore the original file to its original path.")
+	for _, command := range Commands {
+		if command.Hidden {
+			continue
+		}
+		boldWhite("  " + command.Usage())
+		white("    " + command.Summary)
+		white()
+	}
+	white("  Run linksym help <command> to see the flags, examples and exit codes of a command.")
+}
+
+// Print the help of a subcommand, with its summary, flags, examples and exit
+// codes
+func (c *Command) PrintUsage() {
+	white, boldWhite, underlineBoldWhite := helpPrinters()
+
+	underlineBoldWhite("USAGE:")
+	boldWhite("  linksym " + c.Usage())
 	white()
-	boldWhite("  source")
-	white("    Create all symlinks described in the .linksym.yaml configuration file.")
+	white("  " + c.Summary)
+
+	if commandFlags := c.flagsHelp(); len(commandFlags) > 0 {
+		white()
+		underlineBoldWhite("FLAGS:")
+		for _, f := range commandFlags {
+			boldWhite("  " + f.Flags)
+			white("    " + f.Usage)
+		}
+	}
+
+	if len(c.Examples) > 0 {
+		white()
+		underlineBoldWhite("EXAMPLES:")
+		for _, example := range c.Examples {
+			white("  " + example.Description)
+			boldWhite("    $ " + example.Command)
+		}
+	}
+
 	white()
-	boldWhite("  update")
-	white("    Update the .linksym.yaml configuration file in the current directory.")
+	underlineBoldWhite("EXIT CODES:")
+	for _, exitCode := range c.exitCodes() {
+		white(fmt.Sprintf("  %-3s%s", exitCode[0], exitCode[1]))
+	}
 	white()
+	white("  The global flags are accepted too, see linksym --help.")
+}
+
+// Flags of the command as they are listed in its help
+func (c *Command) flagsHelp() []flagHelp {
+	flagSet, _ := c.FlagSet()
+	return flagSetHelp(flagSet)
+}
+
+// Flags of a FlagSet as they are listed in help. Flags sharing a value, like -h
+// and --help, are listed together, with the short name first
+func flagSetHelp(flagSet *flag.FlagSet) []flagHelp {
+	aliases := [][]*flag.Flag{}
+	flagSet.VisitAll(func(f *flag.Flag) {
+		for i, names := range aliases {
+			if sameValue(names[0].Value, f.Value) {
+				aliases[i] = append(names, f)
+				return
+			}
+		}
+		aliases = append(aliases, []*flag.Flag{f})
+	})
+
+	help := []flagHelp{}
+	for _, names := range aliases {
+		slices.SortStableFunc(names, func(a, b *flag.Flag) int { return len(a.Name) - len(b.Name) })
+
+		flagNames := []string{}
+		for _, f := range names {
+			if len(f.Name) == 1 {
+				flagNames = append(flagNames, "-"+f.Name)
+			} else {
+				flagNames = append(flagNames, "--"+f.Name)
+			}
+		}
+
+		f := names[len(names)-1]
+		name, usage := flag.UnquoteUsage(f)
+		flagHelp := flagHelp{strings.Join(flagNames, ", "), usage + "."}
+		if !isBoolFlag(f) {
+			if name == "string" || name == "value" {
+				name = f.Name
+			}
+			flagHelp.Flags += fmt.Sprintf(" <%s>", name)
+		}
+		help = append(help, flagHelp)
+	}
+	return help
+}
+
+// Check if two flags set the same variable, which makes them aliases
+func sameValue(a, b flag.Value) bool {
+	aValue, bValue := reflect.ValueOf(a), reflect.ValueOf(b)
+	return aValue.Kind() == reflect.Pointer && aValue.Type() == bValue.Type() && aValue.Pointer() == bValue.Pointer()
+}
+
+// Exit codes of the command, with what they mean
+func (c *Command) exitCodes() [][2]string {
+	failure := c.Failure
+	if failure == "" {
+		failure = "An error occurred."
+		if c.access == configWrite {
+			failure += " Every change the command made was rolled back."
+		}
+	}
+	return [][2]string{{"0", "The command succeeded."}, {"1", failure}}
 }
@@ -2,35 +2,38 @@ package commands
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 
 	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/flags"
 	"github.com/SwayKh/linksym/logger"
 	"gopkg.in/yaml.v3"
 )
 
-// Initialise and empty config with cwd as init directory
+// Initialise and empty config with the directory of the config as init
+// directory, and add it to the registry so linksym finds it from anywhere
 func (app *Application) Init() error {
-	err := initialiseConfig(app.ConfigName, app.HomeDirectory)
+	err := initialiseConfig(app.ConfigPath, app.HomeDirectory)
 	if err != nil {
 		return err
 	}
-	return nil
-}
 
-// Create a default config file with empty records and Current working directory
-// variable for Init directory
-func initialiseConfig(configPath, homeDir string) error {
-	initDirectory, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("Couldn't get the current working directory")
+	if *flags.DryRunFlag {
+		return nil
 	}
+	return config.RegisterRepository(filepath.Dir(app.ConfigPath), app.ConfigName)
+}
 
+// Create a default config file with empty records and the directory of the
+// config file as the Init directory
+func initialiseConfig(configPath, homeDir string) error {
+	initDirectory := filepath.Dir(configPath)
 	initDirectory = config.AliasPath(initDirectory, homeDir, initDirectory, true)
 
 	configuration := config.AppConfig{}
+	configuration.Version = config.ConfigVersion
 	configuration.InitDirectory = initDirectory
+	configuration.Layout = config.LayoutMirror
 
 	configuration.AliasConfig(homeDir, initDirectory)
 	data, err := yaml.Marshal(configuration)
@@ -38,12 +41,17 @@ func initialiseConfig(configPath, homeDir string) error {
 		return fmt.Errorf("Error marshalling data from configuration{}: %w", err)
 	}
 
-	err = os.WriteFile(configPath, data, 0o644)
+	if *flags.DryRunFlag {
+		logger.Log(logger.INFO, "Would create %s with init directory %s", filepath.Base(configPath), initDirectory)
+		return nil
+	}
+
+	err = config.WriteFileAtomic(configPath, data, 0o644)
 	if err != nil {
 		return fmt.Errorf("Error writing record to config file: %w", err)
 	}
 
-	logger.Log(logger.SUCCESS, "Initialising %s file in the current directory.", filepath.Base(configPath))
+	logger.Log(logger.SUCCESS, "Initialising %s file in %s.", filepath.Base(configPath), initDirectory)
 
 	return nil
 }
@@ -1,12 +1,20 @@
 package commands
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"os/user"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/SwayKh/linksym/config"
 	"github.com/SwayKh/linksym/flags"
+	"github.com/SwayKh/linksym/link"
+	"github.com/SwayKh/linksym/logger"
 )
 
 type Application struct {
@@ -15,87 +23,297 @@ type Application struct {
 	ConfigPath    string
 	HomeDirectory string
 	InitDirectory string
+
+	// Name of the subcommand being run
+	Subcommand string
+
+	// How existing files are handled when moving files or creating symlinks, and
+	// where they are backed up to. Set in Run() from flags and the config
+	Conflict        link.ConflictPolicy
+	BackupDirectory string
+
+	// Machine the conditions of records are evaluated against, which can be
+	// overridden with the --host and --os flags
+	Machine config.Machine
+
+	// Commit the changes of the command to git, set with the --commit flag
+	Commit bool
 }
 
 func (app *Application) Run() error {
-	flags.CreateFlags()
-	flag.Parse()
+	// The global flags before the subcommand are parsed first, to find the
+	// subcommand. Its FlagSet parses the rest of the line, which accepts the
+	// global flags too
+	globalFlags := flag.NewFlagSet("linksym", flag.ContinueOnError)
+	globalFlags.SetOutput(io.Discard)
+	flags.CreateFlags(globalFlags)
+	err := globalFlags.Parse(os.Args[1:])
+	if err != nil {
+		return fmt.Errorf("%s. Please use -h or --help flags to see available commands.", err)
+	}
 
-	if len(flag.Args()) < 1 {
+	if globalFlags.NArg() < 1 {
 		Help()
 		return nil
 	}
 
+	app.Subcommand = globalFlags.Arg(0)
+	command := FindCommand(app.Subcommand)
+	if command == nil {
+		return fmt.Errorf("Invalid Command. Please use -h or --help flags to see available commands.")
+	}
+
+	args, run, err := command.Parse(globalFlags.Args()[1:])
+	if err != nil {
+		return err
+	}
+
 	if *flags.HelpFlag {
-		Help()
+		command.PrintUsage()
 		return nil
 	}
 
-	subcommand := flag.Arg(0)
-	args := flag.Args()[1:]
+	switch *flags.OutputFlag {
+	case logger.OutputText, logger.OutputJSON:
+	default:
+		return fmt.Errorf("Invalid output format %q. Valid formats are text and json", *flags.OutputFlag)
+	}
+
+	// Completion finds the config on its own, and only if it needs it
+	if command.access == configUnused {
+		return run(app, args)
+	}
+
+	// Init creates the config in the directory given with -C, or the current
+	// directory. Every other command finds an existing config
+	if command.access == configNone {
+		app.ConfigPath, err = filepath.Abs(filepath.Join(*flags.ConfigFlag, app.ConfigName))
+		if err != nil {
+			return fmt.Errorf("Error getting absolute path of %s: %w", app.ConfigName, err)
+		}
+	} else {
+		app.ConfigPath, err = config.FindConfig(app.ConfigName, *flags.ConfigFlag)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Validate reads the config file as it is, so it reports problems that would
+	// stop the config from loading
+	if command.access == configRaw {
+		return run(app, args)
+	}
+
+	// Hold the lock for the whole load, change and write cycle of the config.
+	// Dry runs only read the config and don't need it. Commands that only read
+	// the config don't wait for another instance, they read the config as it
+	// is instead, without migrating it or writing IDs. Recover changes the
+	// files of the other instance, so it always needs the lock
+	readOnly := false
+	if !*flags.DryRunFlag {
+		lock, err := config.AcquireLock(filepath.Dir(app.ConfigPath))
+		if errors.Is(err, config.ErrLocked) && command.access == configRead {
+			logger.VerboseLog(logger.WARNING, "%v, reading %s without changing it", err, app.ConfigName)
+			readOnly = true
+		} else if err != nil {
+			return err
+		} else {
+			defer lock.Release()
+		}
+	}
 
 	// Since the Init Command creates the config file, the LoadConfig function
 	// can't be called before handling the init subcommand.
 	// But Init function calls aliasPath, which requires HomeDirectory variable,
 	// and InitialiseHomePath needs be called before this.
-	if subcommand == "init" {
-		if len(args) > 0 {
-			return fmt.Errorf("'init' subcommand doesn't accept any arguments.\nUsage: linksym init")
-		}
-		return app.Init()
+	if command.access == configNone {
+		return run(app, args)
 	}
 
-	configuration, err := config.LoadConfig(app.ConfigName)
+	load := config.LoadConfig
+	if readOnly {
+		load = config.ReadConfig
+	}
+	configuration, err := load(app.ConfigPath)
 	if err != nil {
 		return err
 	}
 
 	app.Configuration = configuration
 	app.InitDirectory = config.ExpandPath(configuration.InitDirectory, app.HomeDirectory, configuration.InitDirectory)
-	app.ConfigPath = filepath.Join(app.InitDirectory, app.ConfigName)
 
-	app.Configuration.UnAliasConfig(app.HomeDirectory, app.InitDirectory)
+	if app.InitDirectory != filepath.Dir(app.ConfigPath) && command.Name != "update" {
+		configDir := config.AliasPath(filepath.Dir(app.ConfigPath), app.HomeDirectory, app.InitDirectory, true)
+		logger.Log(logger.WARNING, "%s is in %s, but its init directory is %s. Run linksym update if it was moved", app.ConfigName, configDir, config.AliasPath(app.InitDirectory, app.HomeDirectory, app.InitDirectory, true))
+	}
 
-	switch subcommand {
-	case "add":
-		if len(args) > 2 {
-			return fmt.Errorf("'add' subcommand doesn't accept more than 2 arguments.\nUsage: linksym add <source> <destination (optional)>")
+	// Records that were added to the config by hand don't have IDs yet. They
+	// are written right away, so the IDs stay the same for commands that don't
+	// write the config, like status
+	if app.Configuration.AssignRecordIDs() && !*flags.DryRunFlag && !readOnly {
+		logger.Log(logger.INFO, "Assigning IDs to records in %s", app.ConfigName)
+		err = app.Configuration.WriteConfig(app.HomeDirectory, app.InitDirectory, app.ConfigPath)
+		if err != nil {
+			return err
 		}
-		err = app.Add(args, true, true)
+	}
 
-	case "remove":
-		err = app.Remove(args)
+	app.Configuration.UnAliasConfig(app.HomeDirectory, app.InitDirectory)
 
-	case "record":
-		if len(args) > 2 {
-			return fmt.Errorf("'record' subcommand doesn't accept more than 2 arguments.\nUsage: linksym record <source> <destination (optional)>")
-		}
-		err = app.Add(args, false, true)
+	// The --on-conflict flag takes priority over the on_conflict config field
+	conflictPolicy := app.Configuration.OnConflict
+	if *flags.OnConflictFlag != "" {
+		conflictPolicy = *flags.OnConflictFlag
+	}
+	app.Conflict, err = link.ParseConflictPolicy(conflictPolicy)
+	if err != nil {
+		return err
+	}
 
-	case "source":
-		if len(args) > 0 {
-			return fmt.Errorf("'source' subcommand doesn't accept any arguments.\nUsage: linksym source")
-		}
-		err = app.Source()
+	switch app.Configuration.Layout {
+	case "", config.LayoutFlat, config.LayoutMirror:
+	default:
+		return fmt.Errorf("Invalid layout %q in %s. Valid layouts are flat and mirror", app.Configuration.Layout, app.ConfigName)
+	}
 
-	case "update":
-		if len(args) > 0 {
-			return fmt.Errorf("'update subcommand doesn't accept any arguments.\nUsage: linksym update")
+	for _, record := range app.Configuration.Records {
+		err = config.ValidateMode(record.LinkMode())
+		if err != nil {
+			return fmt.Errorf("Record %s in %s: %w", record.Label(), app.ConfigName, err)
 		}
-		err = app.Update()
-
-	default:
-		err = fmt.Errorf("Invalid Command. Please use -h or --help flags to see available commands.")
 	}
 
+	app.Machine, err = config.CurrentMachine(*flags.HostFlag, *flags.OSFlag)
 	if err != nil {
 		return err
 	}
 
-	app.Configuration.AliasConfig(app.HomeDirectory, app.InitDirectory)
-	if err := app.Configuration.WriteConfig(app.HomeDirectory, app.InitDirectory, app.ConfigPath); err != nil {
+	// Every invocation gets its own backup directory, so backups never
+	// overwrite each other. The state directory is the one next to the config,
+	// which is the init directory unless the dotfiles directory was moved
+	timestamp := time.Now().Format("2006-01-02T15-04-05")
+	app.BackupDirectory = filepath.Join(config.StateDirectory(filepath.Dir(app.ConfigPath)), "backups", timestamp)
+
+	// Commands that only read the filesystem, like status and list, don't need
+	// the journal, and the config doesn't need to be written back. Recover
+	// handles the journal itself
+	if command.access == configRead || command.access == configRecover {
+		return run(app, args)
+	}
+
+	// A journal left behind means a previous run was interrupted, and has to be
+	// recovered before anything else is changed
+	if link.HasJournal(app.ConfigPath) {
+		return link.ErrUnfinishedJournal
+	}
+
+	// Every change to the filesystem and the config is recorded in a journal,
+	// so a failed run can be rolled back completely
+	if !*flags.DryRunFlag {
+		err = link.BeginJournal(app.HomeDirectory, app.InitDirectory, app.ConfigPath)
+	}
+
+	records := cloneRecords(app.Configuration.Records)
+	if err == nil {
+		err = run(app, args)
+	}
+
+	// The changed files are found before the paths of the records are aliased
+	// for writing the config
+	toCommit := err == nil && command.commits && (app.Commit || app.Configuration.AutoCommit)
+	var changes gitChanges
+	if toCommit {
+		changes = app.gitChanges(command.Name, records)
+	}
+
+	if err == nil {
+		app.Configuration.AliasConfig(app.HomeDirectory, app.InitDirectory)
+		err = app.Configuration.WriteConfig(app.HomeDirectory, app.InitDirectory, app.ConfigPath)
+	}
+
+	if err != nil {
+		if rollbackErr := link.RollbackJournal(); rollbackErr != nil {
+			return fmt.Errorf("%w\n%w", err, rollbackErr)
+		}
 		return err
 	}
 
-	return nil
+	if *flags.DryRunFlag {
+		logger.Log(logger.WARNING, "Dry run, nothing was changed.")
+	}
+
+	err = link.CommitJournal()
+	if err == nil && toCommit {
+		app.commitChanges(changes)
+	}
+	return err
+}
+
+// Create the LinkPaths for a source and destination path, with the directories
+// and conflict handling of this Application
+func (app *Application) linkPaths(sourcePath, destinationPath string, isDirectory bool) link.LinkPaths {
+	return link.LinkPaths{
+		SourcePath:      sourcePath,
+		DestinationPath: destinationPath,
+		HomeDir:         app.HomeDirectory,
+		InitDir:         app.InitDirectory,
+		IsDirectory:     isDirectory,
+		Relative:        app.Configuration.Relative,
+		Conflict:        app.Conflict,
+		BackupDir:       app.BackupDirectory,
+		Mode:            config.ModeSymlink,
+	}
+}
+
+// Create the LinkPaths for an existing record, with the settings of the record
+func (app *Application) recordPaths(record config.Record) (link.LinkPaths, error) {
+	if len(record.Paths) != 2 {
+		return link.LinkPaths{}, fmt.Errorf("Record %s should have 2 paths, but has %d", record.Label(), len(record.Paths))
+	}
+	if err := record.PathError(); err != nil {
+		return link.LinkPaths{}, fmt.Errorf("Record %s: %w", record.Label(), err)
+	}
+
+	destination, err := config.GetFileInfo(record.Paths[1])
+	if err != nil {
+		return link.LinkPaths{}, err
+	}
+
+	paths := app.linkPaths(record.Paths[0], record.Paths[1], destination.IsDir)
+	paths.Relative = app.Configuration.IsRelative(record)
+	paths.Mode = record.LinkMode()
+	if paths.Mode == config.ModeTemplate {
+		paths.Data = app.templateData()
+	}
+	return paths, nil
+}
+
+// Get the values templates are rendered with, for the machine the records are
+// evaluated against
+func (app *Application) templateData() link.TemplateData {
+	env := map[string]string{}
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		env[name] = value
+	}
+
+	username := os.Getenv("USER")
+	if current, err := user.Current(); err == nil {
+		username = current.Username
+	}
+
+	variables := app.Configuration.Variables
+	if variables == nil {
+		variables = map[string]string{}
+	}
+
+	return link.TemplateData{
+		Hostname: app.Machine.Hostname,
+		OS:       app.Machine.OS,
+		Arch:     app.Machine.Arch,
+		Home:     app.HomeDirectory,
+		User:     username,
+		Vars:     variables,
+		Env:      env,
+	}
 }
@@ -0,0 +1,229 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/logger"
+)
+
+// Options of the list subcommand, set with its flags
+type ListOptions struct {
+	Name   string
+	Path   string
+	State  string
+	Tags   []string
+	Sort   string
+	Format string
+}
+
+// A record as shown by linksym list, and the fields available in --format
+// templates
+type ListRow struct {
+	ID          string
+	Name        string
+	Label       string
+	Source      string
+	Destination string
+	Mode        string
+	Tags        []string
+	State       string
+
+	// Name of the state in the JSON output, used to filter by state
+	stateName string
+	record    config.Record
+}
+
+// Orders the rows can be sorted in with --sort. Without it, records are listed
+// in the order of the config
+var listSorts = map[string]func(a, b ListRow) int{
+	"name":        func(a, b ListRow) int { return strings.Compare(a.Label, b.Label) },
+	"source":      func(a, b ListRow) int { return strings.Compare(a.Source, b.Source) },
+	"destination": func(a, b ListRow) int { return strings.Compare(a.Destination, b.Destination) },
+	"mode":        func(a, b ListRow) int { return strings.Compare(a.Mode, b.Mode) },
+	"state":       func(a, b ListRow) int { return strings.Compare(a.State, b.State) },
+}
+
+// Define the flags of the list subcommand
+func listSetup(flagSet *flag.FlagSet) func(*Application, []string) error {
+	options := ListOptions{}
+	flagSet.StringVar(&options.Name, "name", "", "Only list records whose name or ID matches this `glob`")
+	flagSet.StringVar(&options.Path, "path", "", "Only list records with a path starting with this `prefix`")
+	flagSet.StringVar(&options.State, "state", "", "Only list records in this state")
+	flagSet.Var((*stringList)(&options.Tags), "tag", "Only list records with this tag, can be given more than once")
+	flagSet.StringVar(&options.Sort, "sort", "", "Sort by name, source, destination, mode or state, given as the `field`")
+	flagSet.StringVar(&options.Format, "format", "", "Print each record with this Go `template`")
+
+	return func(app *Application, args []string) error {
+		return app.List(options)
+	}
+}
+
+// List the records in the config as a table, with their state on the
+// filesystem. Records can be filtered by a glob of their name, a prefix of
+// either path, their state and their tags, sorted, and printed with a custom
+// template instead of the table
+func (app *Application) List(options ListOptions) error {
+	if _, err := filepath.Match(options.Name, ""); err != nil {
+		return fmt.Errorf("Invalid name pattern %q: %w", options.Name, err)
+	}
+
+	sortFunc, ok := listSorts[options.Sort]
+	if options.Sort != "" && !ok {
+		return fmt.Errorf("Invalid sort %q. Valid sorts are name, source, destination, mode and state", options.Sort)
+	}
+
+	var format *template.Template
+	if options.Format != "" {
+		var err error
+		format, err = template.New("format").Option("missingkey=error").Funcs(template.FuncMap{
+			"join": strings.Join,
+		}).Parse(options.Format)
+		if err != nil {
+			return fmt.Errorf("Invalid format: %w", err)
+		}
+	}
+
+	// Prefixes are paths like the ones in the config, relative to the current
+	// directory unless they start with ~ or $init_directory
+	pathPrefix := ""
+	if options.Path != "" {
+		pathPrefix = config.ExpandPath(options.Path, app.HomeDirectory, app.InitDirectory)
+		if absPath, err := filepath.Abs(pathPrefix); err == nil {
+			pathPrefix = absPath
+		}
+	}
+
+	rows := []ListRow{}
+	for _, record := range app.Configuration.Records {
+		if options.Name != "" {
+			if matched, _ := filepath.Match(options.Name, record.Label()); !matched {
+				if matched, _ := filepath.Match(options.Name, record.ID); !matched {
+					continue
+				}
+			}
+		}
+
+		if !hasTags(record, options.Tags) {
+			continue
+		}
+		if pathPrefix != "" && !hasPathPrefix(record.Paths, pathPrefix) {
+			continue
+		}
+
+		row, err := app.listRow(record)
+		if err != nil {
+			return err
+		}
+		if options.State != "" && options.State != row.stateName && options.State != row.State {
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	if sortFunc != nil {
+		slices.SortStableFunc(rows, sortFunc)
+	}
+
+	for _, row := range rows {
+		event := row.record.Event()
+		event.State = row.stateName
+		logger.Emit(event)
+	}
+	if logger.JSONOutput() {
+		return nil
+	}
+
+	if format != nil {
+		for _, row := range rows {
+			err := format.Execute(os.Stdout, row)
+			if err != nil {
+				return fmt.Errorf("Error formatting record %s: %w", row.Label, err)
+			}
+			fmt.Fprintln(os.Stdout)
+		}
+		return nil
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tSYMLINK\tREPO PATH\tKIND\tTAGS\tSTATE")
+	for _, row := range rows {
+		tags := strings.Join(row.Tags, ",")
+		if tags == "" {
+			tags = "-"
+		}
+		source := config.AliasPath(row.Source, app.HomeDirectory, app.InitDirectory, true)
+		destination := config.AliasPath(row.Destination, app.HomeDirectory, app.InitDirectory, true)
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n", row.Label, source, destination, row.Mode, tags, row.State)
+	}
+	return table.Flush()
+}
+
+// Get the row of a record, with its state on the filesystem. Records whose
+// conditions don't match the machine aren't checked, and are skipped
+func (app *Application) listRow(record config.Record) (ListRow, error) {
+	row := ListRow{
+		ID:     record.ID,
+		Name:   record.Name,
+		Label:  record.Label(),
+		Mode:   record.LinkMode(),
+		Tags:   record.Tags,
+		record: record,
+	}
+	if row.Tags == nil {
+		row.Tags = []string{}
+	}
+
+	if len(record.Paths) != 2 {
+		row.State, row.stateName = "invalid", "invalid"
+		return row, nil
+	}
+	row.Source, row.Destination = record.Paths[0], record.Paths[1]
+
+	matches, _, err := record.Matches(app.Machine, app.HomeDirectory, app.InitDirectory)
+	if err != nil {
+		return ListRow{}, err
+	}
+	if !matches {
+		row.State, row.stateName = "skipped", "skipped"
+		return row, nil
+	}
+
+	paths, err := app.recordPaths(record)
+	if err != nil {
+		return ListRow{}, err
+	}
+	state, err := paths.State()
+	if err != nil {
+		return ListRow{}, err
+	}
+	row.State, row.stateName = state.String(), state.Name()
+	return row, nil
+}
+
+// Check if the record has every tag
+func hasTags(record config.Record, tags []string) bool {
+	for _, tag := range tags {
+		if !record.HasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check if any of the paths starts with the prefix
+func hasPathPrefix(paths []string, prefix string) bool {
+	for _, path := range paths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The man command writes the pages of every command, so it's added to the
+// command table here instead of in its definition
+func init() {
+	Commands = append(Commands, &Command{
+		Name:    "man",
+		Args:    "[directory]",
+		Summary: "Print the linksym(1) man page, or write the man pages of linksym and every command to a directory.",
+		MaxArgs: 1,
+		access:  configUnused,
+		Examples: []Example{
+			{"Read the man page", "linksym man | man -l -"},
+			{"Install the man pages when packaging", "linksym man /usr/share/man/man1"},
+		},
+		Setup: func(*flag.FlagSet) func(*Application, []string) error {
+			return (*Application).Man
+		},
+	})
+}
+
+// Print the man page of linksym, or write the man pages of linksym and every
+// command to a directory, as linksym.1 and linksym-<command>.1
+func (app *Application) Man(args []string) error {
+	if len(args) == 0 {
+		writeManPage(os.Stdout)
+		return nil
+	}
+
+	directory := args[0]
+	err := os.MkdirAll(directory, 0o755)
+	if err != nil {
+		return fmt.Errorf("Error creating directory %s: %w", directory, err)
+	}
+
+	pages := map[string]func(io.Writer){"linksym.1": writeManPage}
+	for _, command := range Commands {
+		if !command.Hidden {
+			pages["linksym-"+command.Name+".1"] = command.writeManPage
+		}
+	}
+
+	for name, write := range pages {
+		file, err := os.Create(filepath.Join(directory, name))
+		if err != nil {
+			return fmt.Errorf("Error creating man page %s: %w", name, err)
+		}
+		write(file)
+		err = file.Close()
+		if err != nil {
+			return fmt.Errorf("Error writing man page %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Write the man page of linksym, with the global flags and every command
+func writeManPage(w io.Writer) {
+	fmt.Fprintln(w, `.TH LINKSYM 1 "" "linksym" "User Commands"`)
+	fmt.Fprintln(w, ".SH NAME")
+	fmt.Fprintln(w, `linksym \- manage dotfiles with symlinks recorded in .linksym.yaml`)
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	fmt.Fprintln(w, `.B linksym
+[\fIflags\fR] \fIcommand\fR [\fIarguments\fR]`)
+	fmt.Fprintln(w, ".SH DESCRIPTION")
+	fmt.Fprintln(w, roffEscape("linksym moves files into a dotfiles directory and links them back to where they were, "+
+		"keeping a record of every symlink in .linksym.yaml, so they can be recreated on another machine with linksym source. "+
+		"Flags can be given anywhere on the command line, and every argument after -- is taken as it is."))
+	fmt.Fprintln(w, ".SH OPTIONS")
+	for _, f := range globalFlagsHelp() {
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roffEscape(f.Flags), roffEscape(f.Usage))
+	}
+	fmt.Fprintln(w, ".SH COMMANDS")
+	seeAlso := []string{}
+	for _, command := range Commands {
+		if command.Hidden {
+			continue
+		}
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roffEscape(command.Usage()), roffEscape(command.Summary))
+		seeAlso = append(seeAlso, fmt.Sprintf(".BR linksym\\-%s (1)", roffEscape(command.Name)))
+	}
+	fmt.Fprintln(w, ".SH EXIT STATUS")
+	fmt.Fprintln(w, roffEscape("linksym exits with 0 on success, and 1 on failure. See the page of each command for when it fails."))
+	fmt.Fprintln(w, ".SH SEE ALSO")
+	fmt.Fprintln(w, strings.Join(seeAlso, ",\n"))
+}
+
+// Write the man page of the command, with its flags, examples and exit codes
+func (c *Command) writeManPage(w io.Writer) {
+	fmt.Fprintf(w, ".TH LINKSYM\\-%s 1 \"\" \"linksym\" \"User Commands\"\n", roffEscape(strings.ToUpper(c.Name)))
+	fmt.Fprintln(w, ".SH NAME")
+	fmt.Fprintf(w, "linksym\\-%s \\- %s\n", roffEscape(c.Name), roffEscape(c.Summary))
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	fmt.Fprintf(w, ".B linksym\n%s\n", roffEscape(c.Usage()))
+	fmt.Fprintln(w, ".SH DESCRIPTION")
+	fmt.Fprintln(w, roffEscape(c.Summary))
+
+	if commandFlags := c.flagsHelp(); len(commandFlags) > 0 {
+		fmt.Fprintln(w, ".SH OPTIONS")
+		for _, f := range commandFlags {
+			fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roffEscape(f.Flags), roffEscape(f.Usage))
+		}
+	}
+	fmt.Fprintln(w, ".PP")
+	fmt.Fprintln(w, roffEscape("The global flags are accepted too, see linksym(1)."))
+
+	if len(c.Examples) > 0 {
+		fmt.Fprintln(w, ".SH EXAMPLES")
+		for _, example := range c.Examples {
+			fmt.Fprintf(w, ".PP\n%s\n.PP\n.RS 4\n.nf\n%s\n.fi\n.RE\n", roffEscape(example.Description), roffEscape("$ "+example.Command))
+		}
+	}
+
+	fmt.Fprintln(w, ".SH EXIT STATUS")
+	for _, exitCode := range c.exitCodes() {
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", exitCode[0], roffEscape(exitCode[1]))
+	}
+	fmt.Fprintln(w, ".SH SEE ALSO")
+	fmt.Fprintln(w, ".BR linksym (1)")
+}
+
+// Escape text for roff, so backslashes, dashes and lines starting with a dot
+// or quote are printed as they are
+func roffEscape(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\e`)
+	text = strings.ReplaceAll(text, "-", `\-`)
+	if strings.HasPrefix(text, ".") || strings.HasPrefix(text, "'") {
+		text = `\&` + text
+	}
+	return text
+}
@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"errors"
+
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/flags"
+	"github.com/SwayKh/linksym/link"
+	"github.com/SwayKh/linksym/logger"
+)
+
+// Codes of the errors in the JSON output. Scripts can rely on them, unlike
+// the error messages, which may change
+const (
+	CodeConfigNotFound    = "config_not_found"
+	CodeConfigTooNew      = "config_too_new"
+	CodeInvalidConfig     = "invalid_config"
+	CodeRecordNotFound    = "record_not_found"
+	CodeAmbiguousRecord   = "ambiguous_record"
+	CodeDuplicateRecord   = "duplicate_record"
+	CodeFileExists        = "file_exists"
+	CodeNotLinked         = "not_linked"
+	CodeLocked            = "locked"
+	CodeUnfinishedJournal = "unfinished_journal"
+	CodeUsage             = "usage"
+	CodeError             = "error"
+)
+
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{config.ErrConfigNotFound, CodeConfigNotFound},
+	{config.ErrNewerConfig, CodeConfigTooNew},
+	{config.ErrInvalidConfig, CodeInvalidConfig},
+	{config.ErrRecordNotFound, CodeRecordNotFound},
+	{config.ErrAmbiguous, CodeAmbiguousRecord},
+	{config.ErrDuplicate, CodeDuplicateRecord},
+	{link.ErrExists, CodeFileExists},
+	{ErrNotLinked, CodeNotLinked},
+	{config.ErrLocked, CodeLocked},
+	{link.ErrUnfinishedJournal, CodeUnfinishedJournal},
+	{ErrUsage, CodeUsage},
+}
+
+// Get the code of an error for the JSON output, errors without a specific code
+// get the generic "error" code
+func ErrorCode(err error) string {
+	for _, errorCode := range errorCodes {
+		if errors.Is(err, errorCode.err) {
+			return errorCode.code
+		}
+	}
+	return CodeError
+}
+
+// Write the result of the command to the JSON output, as the last event
+func (app *Application) EmitResult(err error) {
+	result := logger.ResultEvent{
+		Command: app.Subcommand,
+		OK:      err == nil,
+		DryRun:  flags.DryRunFlag != nil && *flags.DryRunFlag,
+	}
+	if err != nil {
+		result.Error = &logger.ErrorEvent{Code: ErrorCode(err), Message: err.Error()}
+	}
+	logger.Emit(result)
+}
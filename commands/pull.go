@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/logger"
+)
+
+// Copy the files of copy records that were edited outside of the init
+// directory back into it. Without arguments every copy record is pulled,
+// otherwise only the records matching the arguments
+func (app *Application) Pull(args []string) error {
+	records, err := app.findRecords(args)
+	if err != nil {
+		return err
+	}
+
+	pulled := 0
+	for _, record := range records {
+		if record.LinkMode() != config.ModeCopy {
+			// Only records asked for by name are worth a warning
+			if len(args) > 0 {
+				logger.Log(logger.WARNING, "%s is a %s record, only copy records can be pulled", record.Label(), record.LinkMode())
+			}
+			continue
+		}
+		if err := record.PathError(); err != nil && len(args) == 0 {
+			logger.Log(logger.WARNING, "Skipping %s: %v", record.Label(), err)
+			continue
+		}
+
+		paths, err := app.recordPaths(record)
+		if err != nil {
+			return err
+		}
+
+		err = paths.Pull()
+		if err != nil {
+			return fmt.Errorf("Couldn't pull %s: %w", record.Label(), err)
+		}
+		pulled++
+	}
+
+	logger.Log(logger.SUCCESS, "Pulled %d copy records", pulled)
+	return nil
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/flags"
+	"github.com/SwayKh/linksym/link"
+	"github.com/SwayKh/linksym/logger"
+)
+
+// Handle the journal left behind by an interrupted linksym run. Without
+// arguments the recorded operations are listed, "replay" finishes the
+// interrupted operation and keeps everything that was done, and "revert"
+// undoes every recorded operation and restores the config
+func (app *Application) Recover(args []string) error {
+	journal, err := link.LoadJournal(app.HomeDirectory, app.InitDirectory, app.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	for _, op := range journal.Operations {
+		state := "done"
+		msgColor := logger.INFO
+		if !op.Done {
+			state = "interrupted"
+			msgColor = logger.WARNING
+		}
+
+		logger.Emit(logger.OperationEvent{Step: op.Step, Action: op.Action, Path: op.Path, Target: op.Target, Done: op.Done})
+
+		aliasPath := config.AliasPath(op.Path, app.HomeDirectory, app.InitDirectory, true)
+		aliasTarget := config.AliasPath(op.Target, app.HomeDirectory, app.InitDirectory, true)
+
+		switch op.Action {
+		case link.ActionConfig, link.ActionMkdir:
+			logger.Log(msgColor, "%-12s %-8s %s", state, op.Action, aliasPath)
+		default:
+			logger.Log(msgColor, "%-12s %-8s %s -> %s", state, op.Action, aliasPath, aliasTarget)
+		}
+	}
+
+	if len(args) == 0 {
+		logger.Log(logger.INFO, "Run linksym recover replay to finish the interrupted run, or linksym recover revert to undo it")
+		return nil
+	}
+
+	switch args[0] {
+	case "replay":
+		if *flags.DryRunFlag {
+			logger.Log(logger.INFO, "Would finish the interrupted operation and keep the rest")
+			return nil
+		}
+		err = journal.Replay()
+		if err != nil {
+			return err
+		}
+		logger.Log(logger.SUCCESS, "Finished the interrupted run. Records it didn't get to write may be missing, run linksym status to check them")
+
+	case "revert":
+		if *flags.DryRunFlag {
+			logger.Log(logger.INFO, "Would undo every operation and restore %s", app.ConfigName)
+			return nil
+		}
+		err = journal.Revert()
+		if err != nil {
+			return err
+		}
+		logger.Log(logger.SUCCESS, "Reverted the interrupted run")
+
+	default:
+		return fmt.Errorf("Invalid argument %s.\nUsage: linksym recover [replay|revert]", args[0])
+	}
+	return nil
+}
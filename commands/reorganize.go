@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/logger"
+)
+
+// Switch the init directory to the mirror layout. The file of every record is
+// moved to its path relative to the home directory, its symlink is pointed to
+// the new path and the record is updated
+func (app *Application) Reorganize() error {
+	app.Configuration.Layout = config.LayoutMirror
+
+	moved := 0
+	for i := range app.Configuration.Records {
+		record := &app.Configuration.Records[i]
+		if err := record.PathError(); err != nil {
+			logger.Log(logger.WARNING, "Skipping %s: %v", record.Label(), err)
+			continue
+		}
+
+		newDestinationPath := app.defaultDestination(record.Paths[0])
+		if newDestinationPath == record.Paths[1] {
+			continue
+		}
+
+		paths, err := app.recordPaths(*record)
+		if err != nil {
+			return err
+		}
+
+		err = paths.Retarget(newDestinationPath)
+		if err != nil {
+			return err
+		}
+
+		record.Paths[1] = newDestinationPath
+		moved++
+	}
+
+	logger.Log(logger.SUCCESS, "Moved %d of %d records to the mirror layout", moved, len(app.Configuration.Records))
+	return nil
+}
@@ -1,32 +1,40 @@
 package commands
 
 import (
-	"os"
-	"path/filepath"
-
 	"github.com/SwayKh/linksym/logger"
 )
 
 // Loop over the configuration []Records, for each entry get the source and
-// destination paths. Run the Link command for each entry.
+// destination paths. Create the symlink for each entry whose conditions match
+// the machine, files already present at the source path are handled by the
+// conflict policy
 func (app *Application) Source() error {
 	logger.VerboseLog(logger.INFO, "Creating Symlinks from .linksym.yaml Records...")
+	skipped := 0
 	for _, record := range app.Configuration.Records {
-		sourcePath := record.Paths[0]
-		destinationPath := filepath.Dir(record.Paths[1])
-
-		err := os.MkdirAll(destinationPath, 0o755)
+		matches, reason, err := record.Matches(app.Machine, app.HomeDirectory, app.InitDirectory)
 		if err != nil {
 			return err
 		}
+		if !matches {
+			logger.Log(logger.INFO, "Skipping %s: %s", record.Label(), reason)
+			skipped++
+			continue
+		}
 
-		pathArgs := []string{sourcePath, destinationPath}
+		paths, err := app.recordPaths(record)
+		if err != nil {
+			return err
+		}
 
-		err = app.Add(pathArgs, true, false)
+		err = paths.Relink()
 		if err != nil {
 			return err
 		}
 	}
+	if skipped > 0 {
+		logger.Log(logger.INFO, "Skipped %d records that don't apply to this machine", skipped)
+	}
 	logger.Log(logger.SUCCESS, "Success")
 	return nil
 }
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/git"
+	"github.com/SwayKh/linksym/logger"
+)
+
+var ErrNotLinked = errors.New("not linked correctly")
+
+// Options of the status subcommand, set with its flags
+type StatusOptions struct {
+	// Show the git state of the file of each record in the init directory
+	Git bool
+}
+
+// Check every record in .linksym.yaml, or only the records matching the
+// arguments, against the filesystem and print the state of each one. Returns an
+// error when any record isn't linked correctly, so the exit code can be checked
+// after pulling the dotfiles on a machine. Records whose conditions don't
+// match the machine are reported as skipped, and don't count as problems.
+// With the Git option, the git state of each file in the init directory is
+// shown too, which never counts as a problem
+func (app *Application) Status(args []string, options StatusOptions) error {
+	problems := 0
+	skipped := 0
+
+	records, err := app.findRecords(args)
+	if err != nil {
+		return err
+	}
+
+	var gitStatus *git.Status
+	if options.Git {
+		gitStatus, err = git.GetStatus(app.InitDirectory)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, record := range records {
+		event := record.Event()
+
+		// Files missing from the init directory have no git state
+		gitState := ""
+		if gitStatus != nil && len(record.Paths) == 2 {
+			if _, err := os.Lstat(record.Paths[1]); err == nil {
+				event.Git = string(gitStatus.State(record.Paths[1]))
+				gitState = "  git: " + event.Git
+			}
+		}
+
+		if len(record.Paths) != 2 {
+			logger.Log(logger.ERROR, "%-18s %s", "invalid record", record.Label())
+			event.State = "invalid"
+			logger.Emit(event)
+			problems++
+			continue
+		}
+
+		matches, reason, err := record.Matches(app.Machine, app.HomeDirectory, app.InitDirectory)
+		if err != nil {
+			return err
+		}
+		if !matches {
+			aliasSourcePath := config.AliasPath(record.Paths[0], app.HomeDirectory, app.InitDirectory, true)
+			logger.Log(logger.INFO, "%-18s %s (%s): %s%s", "skipped", aliasSourcePath, record.Label(), reason, gitState)
+			event.State = "skipped"
+			event.Reason = reason
+			logger.Emit(event)
+			skipped++
+			continue
+		}
+
+		paths, err := app.recordPaths(record)
+		if err != nil {
+			return err
+		}
+
+		state, err := paths.State()
+		if err != nil {
+			return err
+		}
+
+		aliasSourcePath := config.AliasPath(paths.SourcePath, app.HomeDirectory, app.InitDirectory, true)
+		aliasDestinationPath := config.AliasPath(paths.DestinationPath, app.HomeDirectory, app.InitDirectory, true)
+
+		msgColor := logger.SUCCESS
+		if !state.OK() {
+			msgColor = logger.ERROR
+			problems++
+		}
+		logger.Log(msgColor, "%-18s %s -> %s (%s)%s", state, aliasSourcePath, aliasDestinationPath, record.Label(), gitState)
+		event.State = state.Name()
+		logger.Emit(event)
+	}
+
+	total := len(records) - skipped
+	if skipped > 0 {
+		logger.Log(logger.INFO, "Skipped %d records that don't apply to this machine", skipped)
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d of %d records are %w", problems, total, ErrNotLinked)
+	}
+
+	logger.Log(logger.SUCCESS, "All %d records are linked correctly", total)
+	return nil
+}
+
+// Get the records matching each argument, or every record without arguments
+func (app *Application) findRecords(args []string) ([]config.Record, error) {
+	if len(args) == 0 {
+		return app.Configuration.Records, nil
+	}
+
+	records := []config.Record{}
+	for _, arg := range args {
+		record, err := app.Configuration.FindRecord(arg)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+	return records, nil
+}
@@ -1,16 +1,16 @@
 package commands
 
 import (
-	"fmt"
-	"os"
 	"path/filepath"
 
 	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/flags"
 	"github.com/SwayKh/linksym/logger"
 )
 
-// Update the $init_directory variable in the config and update the record names
-// based on the new destination path with $init_directory
+// Update the $init_directory variable in the config to the directory the config
+// is in, give records without an ID a new one, and add the directory to the
+// registry
 func (app *Application) Update() error {
 	// Alias config, to be allow expanding the $init_directory variable with the
 	// new InitDirectory
@@ -18,31 +18,28 @@ func (app *Application) Update() error {
 
 	logger.Log(logger.INFO, "Updating .linksym.yaml file...")
 
-	InitDirectory, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("Couldn't get the current working directory")
+	InitDirectory := filepath.Dir(app.ConfigPath)
+
+	if *flags.DryRunFlag && InitDirectory != app.InitDirectory {
+		logger.Log(logger.INFO, "Would change init directory to %s", config.AliasPath(InitDirectory, app.HomeDirectory, InitDirectory, true))
 	}
 
 	app.InitDirectory = config.ExpandPath(InitDirectory, app.HomeDirectory, InitDirectory)
-	app.ConfigPath = filepath.Join(app.InitDirectory, app.ConfigName)
 	app.Configuration.InitDirectory = InitDirectory
 
-	for i := range app.Configuration.Records {
-		destinationPath := config.ExpandPath(app.Configuration.Records[i].Paths[1], app.HomeDirectory, app.InitDirectory)
-		filename := filepath.Base(destinationPath)
-		dirname := filepath.Base(filepath.Dir(destinationPath))
-
-		app.Configuration.Records[i].Name = filepath.Join(dirname, filename)
-
-	}
+	// Records that were added to the config by hand don't have IDs yet
+	app.Configuration.AssignRecordIDs()
 
-	logger.Log(logger.SUCCESS, "Successfully updates Init Directory and Record names")
+	logger.Log(logger.SUCCESS, "Successfully updated Init Directory")
 
 	app.Configuration.AliasConfig(app.HomeDirectory, app.InitDirectory)
-	err = app.Configuration.WriteConfig(app.HomeDirectory, app.InitDirectory, app.ConfigPath)
+	err := app.Configuration.WriteConfig(app.HomeDirectory, app.InitDirectory, app.ConfigPath)
 	if err != nil {
-		return nil
+		return err
 	}
 
-	return nil
+	if *flags.DryRunFlag {
+		return nil
+	}
+	return config.RegisterRepository(app.InitDirectory, app.ConfigName)
 }
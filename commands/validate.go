@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/link"
+	"github.com/SwayKh/linksym/logger"
+)
+
+// Check the config file and report every problem with its line and column, and
+// how to fix it. Returns an error if any problem is an error, so it can be used
+// as a pre-commit hook. The config is only read, never migrated or written
+func (app *Application) Validate() error {
+	diagnostics, err := config.Validate(app.ConfigPath, app.HomeDirectory, func(policy string) error {
+		_, err := link.ParseConflictPolicy(policy)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	errors, warnings := 0, 0
+	for _, diagnostic := range diagnostics {
+		logger.Emit(logger.DiagnosticEvent{
+			File:     diagnostic.File,
+			Line:     diagnostic.Line,
+			Column:   diagnostic.Column,
+			Severity: string(diagnostic.Severity),
+			Message:  diagnostic.Message,
+			Fix:      diagnostic.Fix,
+		})
+
+		if diagnostic.Severity == config.SeverityError {
+			logger.Log(logger.ERROR, "%s", diagnostic)
+			errors++
+		} else {
+			logger.Log(logger.WARNING, "%s", diagnostic)
+			warnings++
+		}
+	}
+
+	if errors > 0 {
+		return fmt.Errorf("%w, found %d errors and %d warnings in %s", config.ErrInvalidConfig, errors, warnings, app.ConfigName)
+	}
+	if warnings > 0 {
+		logger.Log(logger.WARNING, "Found %d warnings in %s", warnings, app.ConfigName)
+		return nil
+	}
+	logger.Log(logger.SUCCESS, "%s is valid", app.ConfigName)
+	return nil
+}
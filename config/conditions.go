@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Conditions a machine has to meet for a record to be linked on it. Every
+// condition that is set has to match. Hosts, OS and Arch match if any of their
+// values match, Env, Executables and Files match if all of them are present
+type Conditions struct {
+	Hosts       []string `yaml:"hosts,omitempty"`
+	OS          []string `yaml:"os,omitempty"`
+	Arch        []string `yaml:"arch,omitempty"`
+	Env         []string `yaml:"env,omitempty"`
+	Executables []string `yaml:"executables,omitempty"`
+	Files       []string `yaml:"files,omitempty"`
+}
+
+// The machine conditions are evaluated against. It's the current machine,
+// unless the hostname or OS are overridden with the --host and --os flags
+type Machine struct {
+	Hostname string
+	OS       string
+	Arch     string
+}
+
+// Get the Machine for the current host, with the hostname and OS replaced by
+// the overrides when they aren't empty
+func CurrentMachine(hostOverride, osOverride string) (Machine, error) {
+	machine := Machine{
+		Hostname: hostOverride,
+		OS:       osOverride,
+		Arch:     runtime.GOARCH,
+	}
+
+	if machine.Hostname == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return Machine{}, fmt.Errorf("Error getting hostname: %w", err)
+		}
+		machine.Hostname = hostname
+	}
+
+	if machine.OS == "" {
+		machine.OS = runtime.GOOS
+	}
+	return machine, nil
+}
+
+// Check if the record should be linked on the machine. When it shouldn't, the
+// reason is returned, to tell the user why the record is skipped. Records whose
+// paths couldn't be expanded never match
+func (r Record) Matches(machine Machine, homeDir, initDir string) (bool, string, error) {
+	if r.pathErr != nil {
+		return false, fmt.Sprintf("paths can't be expanded: %v", r.pathErr), nil
+	}
+	if r.When == nil {
+		return true, "", nil
+	}
+	c := r.When
+
+	if len(c.Hosts) > 0 {
+		matched := false
+		for _, pattern := range c.Hosts {
+			ok, err := filepath.Match(pattern, machine.Hostname)
+			if err != nil {
+				return false, "", fmt.Errorf("Invalid host pattern %q in record %s: %w", pattern, r.Label(), err)
+			}
+			matched = matched || ok
+		}
+		if !matched {
+			return false, fmt.Sprintf("host %s isn't %s", machine.Hostname, strings.Join(c.Hosts, ", ")), nil
+		}
+	}
+
+	if len(c.OS) > 0 && !slices.Contains(c.OS, machine.OS) {
+		return false, fmt.Sprintf("os %s isn't %s", machine.OS, strings.Join(c.OS, ", ")), nil
+	}
+
+	if len(c.Arch) > 0 && !slices.Contains(c.Arch, machine.Arch) {
+		return false, fmt.Sprintf("arch %s isn't %s", machine.Arch, strings.Join(c.Arch, ", ")), nil
+	}
+
+	for _, name := range c.Env {
+		if _, ok := os.LookupEnv(name); !ok {
+			return false, fmt.Sprintf("environment variable %s isn't set", name), nil
+		}
+	}
+
+	for _, name := range c.Executables {
+		if _, err := exec.LookPath(name); err != nil {
+			return false, fmt.Sprintf("executable %s isn't on PATH", name), nil
+		}
+	}
+
+	for _, path := range c.Files {
+		if _, err := os.Stat(ExpandPath(path, homeDir, initDir)); err != nil {
+			return false, fmt.Sprintf("file %s doesn't exist", path), nil
+		}
+	}
+
+	return true, "", nil
+}
@@ -1,75 +1,210 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
+	"github.com/SwayKh/linksym/flags"
 	"github.com/SwayKh/linksym/logger"
+	"gopkg.in/yaml.v3"
 )
 
-type AppConfig struct {
-	InitDirectory string   `yaml:"init_directory"`
-	Records       []record `yaml:"records"`
-}
+// Name of the directory inside the init directory, where linksym keeps backups
+// and other files that aren't part of the dotfiles
+const StateDirName = ".linksym"
 
-type record struct {
-	Name  string   `yaml:"name"`
-	Paths []string `yaml:"paths"`
-}
+// Layouts of the files in the init directory. With the flat layout, files are
+// added directly in the init directory, with the mirror layout, they are added
+// at their path relative to the home directory
+const (
+	LayoutFlat   = "flat"
+	LayoutMirror = "mirror"
+)
 
-// Create a array of Path provided and a Link Name which is appended in the
-// Records of the global Configuration Struct
-func (c *AppConfig) AddRecord(sourcePath string, destinationPath string) {
-	record := record{}
+// Modes of records. A symlink record links the source path to the file in the
+// init directory, a template record renders the file in the init directory to
+// the source path, and a copy record copies it there. A hardlink record is like
+// a symlink record, with a hardlink instead. Records without a mode are
+// symlinks
+const (
+	ModeSymlink  = "symlink"
+	ModeTemplate = "template"
+	ModeCopy     = "copy"
+	ModeHardlink = "hardlink"
+)
 
-	recordSlice := []string{}
-	recordSlice = append(recordSlice, sourcePath, destinationPath)
+type AppConfig struct {
+	Version       int               `yaml:"version"`
+	InitDirectory string            `yaml:"init_directory"`
+	Layout        string            `yaml:"layout,omitempty"`
+	Relative      bool              `yaml:"relative,omitempty"`
+	OnConflict    string            `yaml:"on_conflict,omitempty"`
+	AutoCommit    bool              `yaml:"auto_commit,omitempty"`
+	Variables     map[string]string `yaml:"variables,omitempty"`
+	Records       []Record          `yaml:"records"`
+
+	// The file the config was loaded from, and its indentation. Writes are
+	// merged into it, so comments and formatting are kept
+	document *yaml.Node
+	indent   int
+}
 
-	filename := filepath.Base(destinationPath)
-	dirname := filepath.Base(filepath.Dir(destinationPath))
+// Record of a symlink. Paths holds the source path, where the symlink is
+// created, and the destination path, where the file lives in the init
+// directory. ID is generated when the record is added and never changes, Name
+// is optional and chosen by the user. Relative overrides the relative setting
+// of the AppConfig for this record, and When limits the machines it's linked
+// on. Mode is empty for symlinks, template for records rendered from a template
+// in the init directory, copy for records copied from the init directory, or
+// hardlink. Tags are free-form labels for grouping records in linksym list
+type Record struct {
+	ID       string      `yaml:"id"`
+	Name     string      `yaml:"name,omitempty"`
+	Tags     []string    `yaml:"tags,omitempty"`
+	Mode     string      `yaml:"mode,omitempty"`
+	Paths    []string    `yaml:"paths"`
+	Relative *bool       `yaml:"relative,omitempty"`
+	When     *Conditions `yaml:"when,omitempty"`
+
+	// Paths as written in the config, before their variables were expanded,
+	// and why they couldn't be expanded. Records whose paths can't be expanded
+	// keep the paths as written, and are skipped
+	rawPaths []string
+	pathErr  error
+}
 
-	fileAndDirName := filepath.Join(dirname, filename)
+// Get the error of expanding the paths of the record, if they couldn't be
+// expanded
+func (r Record) PathError() error {
+	return r.pathErr
+}
 
-	record.Name = fileAndDirName
-	record.Paths = recordSlice
+// Give the record a new ID and append it to the Records of the global
+// Configuration Struct
+func (c *AppConfig) AddRecord(record Record) {
+	record.ID = c.newRecordID()
 
 	c.Records = append(c.Records, record)
 
-	logger.Log(logger.INFO, "Adding record to .linksym.yaml...")
+	event := record.Event()
+	event.Change = "added"
+	logger.Emit(event)
+
+	if *flags.DryRunFlag {
+		logger.Log(logger.INFO, "Would add record %s to .linksym.yaml", record.Label())
+		return
+	}
+	logger.Log(logger.INFO, "Adding record %s to .linksym.yaml...", record.Label())
 }
 
-// Remove a Record of Link Name and Path array from the AppConfig struct, which
-// is written to file at the end of program execution
-func (c *AppConfig) RemoveRecord(name string) {
+// Remove the Record with the given ID from the AppConfig struct, which is
+// written to file at the end of program execution
+func (c *AppConfig) RemoveRecord(id string) {
 	for i := len(c.Records) - 1; i >= 0; i-- {
-		if c.Records[i].Name == name {
+		if c.Records[i].ID == id {
+			event := c.Records[i].Event()
+			event.Change = "removed"
+			logger.Emit(event)
+
 			c.Records = append(c.Records[:i], c.Records[i+1:]...)
 		}
 	}
 
-	logger.Log(logger.INFO, "Removing record from .linksym.yaml...")
+	if *flags.DryRunFlag {
+		logger.Log(logger.INFO, "Would remove record %s from .linksym.yaml", id)
+		return
+	}
+	logger.Log(logger.INFO, "Removing record %s from .linksym.yaml...", id)
 }
 
 func (c *AppConfig) AliasConfig(homeDir, initDir string) {
 	c.InitDirectory = AliasPath(c.InitDirectory, homeDir, initDir, true)
 
-	// Alias path absolute paths before writing to config file
-	for i, v := range c.Records {
-		for j := range v.Paths {
-			c.Records[i].Paths[j] = AliasPath(c.Records[i].Paths[j], homeDir, initDir, false)
+	// Alias path absolute paths before writing to config file. Paths written
+	// with variables are written back as they were, unless they were changed
+	for i := range c.Records {
+		record := &c.Records[i]
+		for j, path := range record.Paths {
+			if j < len(record.rawPaths) && strings.Contains(record.rawPaths[j], "$") {
+				expanded, err := c.ExpandRecordPath(record.rawPaths[j], homeDir, initDir)
+				if err == nil && expanded == path {
+					record.Paths[j] = record.rawPaths[j]
+					continue
+				}
+			}
+			record.Paths[j] = AliasPath(path, homeDir, initDir, false)
 		}
 	}
 }
 
+// Expand the paths of every record. A record whose paths can't be expanded,
+// like one using a variable that isn't set, keeps its paths as written and is
+// skipped, so the other records can still be used
 func (c *AppConfig) UnAliasConfig(homeDir, initDir string) {
 	c.InitDirectory = ExpandPath(c.InitDirectory, homeDir, initDir)
 
-	for i, v := range c.Records {
-		for j := range v.Paths {
-			c.Records[i].Paths[j] = ExpandPath(c.Records[i].Paths[j], homeDir, initDir)
+	for i := range c.Records {
+		record := &c.Records[i]
+		record.rawPaths = slices.Clone(record.Paths)
+
+		expanded := make([]string, len(record.Paths))
+		for j, path := range record.Paths {
+			expandedPath, err := c.ExpandRecordPath(path, homeDir, initDir)
+			if err != nil {
+				record.pathErr = err
+				logger.VerboseLog(logger.WARNING, "Skipping record %s: %v", record.Label(), err)
+				break
+			}
+			expanded[j] = expandedPath
+		}
+		if record.pathErr == nil {
+			record.Paths = expanded
+		}
+	}
+}
+
+// Expand the variables, ~ and $init_directory in a path of a record. The path
+// should be absolute once its variables are expanded, or start with ~ or
+// $init_directory
+func (c *AppConfig) ExpandRecordPath(path, homeDir, initDir string) (string, error) {
+	expanded, err := ExpandVariables(path, c.Variables)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(expanded) && !strings.HasPrefix(expanded, "~") && !strings.HasPrefix(expanded, "$init_directory") {
+		return "", fmt.Errorf("Path %s expands to %s, which isn't absolute and doesn't start with ~ or $init_directory", path, expanded)
+	}
+	return ExpandPath(expanded, homeDir, initDir), nil
+}
+
+// Get the path of the linksym state directory for the given init directory
+func StateDirectory(initDir string) string {
+	return filepath.Join(initDir, StateDirName)
+}
+
+// Create the linksym state directory in the init directory, which holds
+// backups and other files that shouldn't be tracked with the dotfiles. The
+// directory ignores itself, so it never shows up in git
+func CreateStateDirectory(initDir string) error {
+	stateDir := StateDirectory(initDir)
+
+	err := os.MkdirAll(stateDir, 0o755)
+	if err != nil {
+		return fmt.Errorf("Failed to create directory %s: %w", stateDir, err)
+	}
+
+	gitignore := filepath.Join(stateDir, ".gitignore")
+	if _, err := os.Stat(gitignore); errors.Is(err, os.ErrNotExist) {
+		err = os.WriteFile(gitignore, []byte("*\n"), 0o644)
+		if err != nil {
+			return fmt.Errorf("Failed to create %s: %w", gitignore, err)
 		}
 	}
+	return nil
 }
 
 func InitialiseHomePath() (string, error) {
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/SwayKh/linksym/logger"
+)
+
+var ErrConfigNotFound = errors.New("No .linksym.yaml file found. Please run linksym init, or use -C to choose a dotfiles directory")
+
+// Find the config file to use, so linksym can be run from any directory. The
+// first of these that has a config file is used:
+//   - the directory or file given with the -C/--config flag
+//   - the current directory and its parents
+//   - the directory or file in $LINKSYM_CONFIG
+//   - the only dotfiles directory in the registry
+func FindConfig(configName, flagPath string) (string, error) {
+	if flagPath != "" {
+		return configFile(flagPath, configName, "--config")
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("Couldn't get the current working directory")
+	}
+
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		configPath := filepath.Join(dir, configName)
+		if _, err := os.Stat(configPath); err == nil {
+			return configPath, nil
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	if envPath := os.Getenv("LINKSYM_CONFIG"); envPath != "" {
+		return configFile(envPath, configName, "$LINKSYM_CONFIG")
+	}
+
+	repositories, err := RegisteredRepositories()
+	if err != nil {
+		return "", err
+	}
+
+	found := []string{}
+	for _, dir := range repositories {
+		configPath := filepath.Join(dir, configName)
+		if _, err := os.Stat(configPath); err == nil {
+			found = append(found, configPath)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", ErrConfigNotFound
+	case 1:
+		logger.VerboseLog(logger.INFO, "Using %s from the registry", found[0])
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("Found %d dotfiles directories in the registry, use -C to choose one:\n  %s", len(found), strings.Join(found, "\n  "))
+	}
+}
+
+// Get the path of the config file from a path given by the user, which can be
+// the config file itself or the directory containing it
+func configFile(path, configName, source string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("Error getting absolute path of %s: %w", path, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("%s from %s doesn't exist", path, source)
+	}
+
+	if info.IsDir() {
+		path = filepath.Join(path, configName)
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("%w in %s from %s", ErrConfigNotFound, filepath.Dir(path), source)
+		}
+	}
+	return path, nil
+}
+
+// Path of the registry of known dotfiles directories, one per line
+func registryPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("Couldn't get the user config directory: %w", err)
+	}
+	return filepath.Join(configDir, "linksym", "repositories"), nil
+}
+
+// Get the dotfiles directories in the registry
+func RegisteredRepositories() ([]string, error) {
+	path, err := registryPath()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Error opening %s: %w", path, err)
+	}
+	defer file.Close()
+
+	repositories := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			repositories = append(repositories, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Error reading %s: %w", path, err)
+	}
+	return repositories, nil
+}
+
+// Add a dotfiles directory to the registry, so linksym finds it from any
+// directory. Directories that no longer have a config file are dropped
+func RegisterRepository(dir, configName string) error {
+	path, err := registryPath()
+	if err != nil {
+		return err
+	}
+
+	repositories, err := RegisteredRepositories()
+	if err != nil {
+		return err
+	}
+
+	kept := []string{}
+	for _, repository := range repositories {
+		if _, err := os.Stat(filepath.Join(repository, configName)); err == nil && repository != dir {
+			kept = append(kept, repository)
+		}
+	}
+	kept = append(kept, dir)
+	if slices.Equal(kept, repositories) {
+		return nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return fmt.Errorf("Failed to create directory %s: %w", filepath.Dir(path), err)
+	}
+
+	return WriteFileAtomic(path, []byte(strings.Join(kept, "\n")+"\n"), 0o644)
+}
@@ -0,0 +1,309 @@
+package config
+
+import (
+	"bytes"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The YAML parser drops blank lines, so they are turned into comments with this
+// text before parsing, and back into blank lines after encoding
+const blankLineMarker = "#linksym:blank"
+
+var blockScalar = regexp.MustCompile(`(^|[:-])\s+[|>][-+0-9]*\s*(#.*)?$`)
+
+// Replace blank lines with marker comments, so they survive parsing. Blank
+// lines inside block scalars are part of their value, so files with block
+// scalars are left alone
+func markBlankLines(data []byte) []byte {
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines {
+		if blockScalar.MatchString(line) {
+			return data
+		}
+	}
+
+	// The last line is empty when the file ends with a newline
+	for i, line := range lines[:len(lines)-1] {
+		if strings.TrimSpace(line) == "" {
+			lines[i] = blankLineMarker
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// Turn the marker comments back into blank lines
+func restoreBlankLines(data []byte) []byte {
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == blankLineMarker {
+			lines[i] = ""
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// Get the indentation used in the file, from its first indented line. Files
+// without indented lines use the indentation of yaml.Marshal
+func detectIndent(data []byte) int {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if indent := len(line) - len(trimmed); indent > 0 {
+			return min(max(indent, 2), 8)
+		}
+	}
+	return 4
+}
+
+// Encode a YAML document with the given indentation, restoring blank lines
+func encodeDocument(document *yaml.Node, indent int) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(indent)
+
+	err := encoder.Encode(document)
+	if err != nil {
+		return nil, err
+	}
+	err = encoder.Close()
+	if err != nil {
+		return nil, err
+	}
+	return restoreBlankLines(buf.Bytes()), nil
+}
+
+// Merge the freshly encoded config into the node of the file it was loaded
+// from, and return the node to use. Nodes that didn't change are kept as they
+// are, with their comments, style, anchors and aliases, so writing the config
+// only changes the parts of the file that changed
+func mergeNode(old, fresh *yaml.Node) *yaml.Node {
+	if old.Kind == yaml.AliasNode {
+		if nodesEqual(old.Alias, fresh) {
+			return old
+		}
+		return fresh
+	}
+
+	if old.Kind != fresh.Kind {
+		fresh.HeadComment = old.HeadComment
+		fresh.LineComment = old.LineComment
+		fresh.FootComment = old.FootComment
+		return fresh
+	}
+
+	// An empty mapping or sequence is written in flow style, like records: [].
+	// It takes the style of the fresh node once it has content
+	if len(old.Content) == 0 && old.Style&yaml.FlowStyle != 0 {
+		old.Style = fresh.Style
+	}
+
+	switch fresh.Kind {
+	case yaml.ScalarNode:
+		if old.ShortTag() != fresh.ShortTag() || old.Value != fresh.Value {
+			old.Value = fresh.Value
+			old.Tag = fresh.Tag
+			old.Style = fresh.Style
+		}
+	case yaml.MappingNode:
+		mergeMapping(old, fresh)
+	case yaml.SequenceNode:
+		mergeSequence(old, fresh)
+	}
+	return old
+}
+
+// Merge the keys of a mapping. Keys keep their order in the file, removed keys
+// are dropped, and new keys are inserted before the next key that follows them
+// in the fresh mapping. Merge keys (<<) are kept, and keys whose value is
+// already inherited through them aren't added
+func mergeMapping(old, fresh *yaml.Node) {
+	content := []*yaml.Node{}
+	for i := 0; i+1 < len(old.Content); i += 2 {
+		key, value := old.Content[i], old.Content[i+1]
+		if key.Value == "<<" {
+			content = append(content, key, value)
+			continue
+		}
+
+		freshValue := mappingValue(fresh, key.Value)
+		if freshValue == nil {
+			continue
+		}
+		content = append(content, key, mergeNode(value, freshValue))
+	}
+
+	for i := 0; i+1 < len(fresh.Content); i += 2 {
+		key, value := fresh.Content[i], fresh.Content[i+1]
+		if mappingValue(old, key.Value) != nil {
+			continue
+		}
+		if inherited := inheritedValue(old, key.Value); inherited != nil && nodesEqual(inherited, value) {
+			continue
+		}
+
+		// Insert the key before the next key of the fresh mapping that's
+		// already in the file, or at the end
+		position := len(content)
+		for j := i + 2; j+1 < len(fresh.Content) && position == len(content); j += 2 {
+			for k := 0; k+1 < len(content); k += 2 {
+				if content[k].Value == fresh.Content[j].Value {
+					position = k
+					break
+				}
+			}
+		}
+		content = append(content[:position], append([]*yaml.Node{key, value}, content[position:]...)...)
+	}
+
+	old.Content = content
+}
+
+// Merge the items of a sequence. Items that are mappings with an id, like
+// records, are matched by their id, or by their paths if the item in the file
+// doesn't have an id yet. Other items are matched by their position
+func mergeSequence(old, fresh *yaml.Node) {
+	byID := map[string]*yaml.Node{}
+	byPaths := map[string]*yaml.Node{}
+	for _, item := range old.Content {
+		if id := mappingValue(item, "id"); id != nil {
+			byID[id.Value] = item
+		} else if paths := mappingValue(item, "paths"); paths != nil {
+			byPaths[scalarValues(paths)] = item
+		}
+	}
+
+	content := []*yaml.Node{}
+	for i, item := range fresh.Content {
+		id := mappingValue(item, "id")
+		if id == nil {
+			if i < len(old.Content) {
+				item = mergeNode(old.Content[i], item)
+			}
+			content = append(content, item)
+			continue
+		}
+
+		match := byID[id.Value]
+		if match == nil {
+			if paths := mappingValue(item, "paths"); paths != nil {
+				match = byPaths[scalarValues(paths)]
+			}
+		}
+		if match != nil {
+			item = mergeNode(match, item)
+		}
+		content = append(content, item)
+	}
+
+	// The blank line before the last item is a foot comment at the end of the
+	// item before it, and isn't needed once the last item was removed
+	if len(old.Content) > 0 && len(content) > 0 && !slices.Contains(content, old.Content[len(old.Content)-1]) {
+		last := lastNode(content[len(content)-1])
+		if strings.Trim(strings.ReplaceAll(last.FootComment, blankLineMarker, ""), "\n") == "" {
+			last.FootComment = lastNode(old.Content[len(old.Content)-1]).FootComment
+		}
+	}
+
+	old.Content = content
+}
+
+// Get the node a node ends with, which holds the comments after it
+func lastNode(node *yaml.Node) *yaml.Node {
+	for node.Kind != yaml.AliasNode && len(node.Content) > 0 {
+		node = node.Content[len(node.Content)-1]
+	}
+	return node
+}
+
+// Fix the aliases of a document whose anchored node was removed, or moved after
+// its aliases, so it can be parsed again. The first alias of such a node is
+// replaced by a copy of it that takes over the anchor
+func fixAliases(node *yaml.Node) {
+	fixAliasesIn(node, map[*yaml.Node]bool{}, map[*yaml.Node]*yaml.Node{})
+}
+
+func fixAliasesIn(node *yaml.Node, seen map[*yaml.Node]bool, moved map[*yaml.Node]*yaml.Node) {
+	for i, child := range node.Content {
+		if child.Kind == yaml.AliasNode {
+			if copied, ok := moved[child.Alias]; ok {
+				child.Alias = copied
+			} else if !seen[child.Alias] {
+				copied := *child.Alias
+				copied.HeadComment = child.HeadComment
+				copied.LineComment = child.LineComment
+				copied.FootComment = child.FootComment
+				moved[child.Alias] = &copied
+				node.Content[i] = &copied
+				child = &copied
+			}
+		} else if _, ok := moved[child]; ok {
+			child.Anchor = ""
+		}
+
+		if child.Anchor != "" {
+			seen[child] = true
+		}
+		if child.Kind != yaml.AliasNode {
+			fixAliasesIn(child, seen, moved)
+		}
+	}
+}
+
+// Get the value of a key inherited through the merge keys of a mapping
+func inheritedValue(node *yaml.Node, key string) *yaml.Node {
+	merge := mappingValue(node, "<<")
+	if merge == nil {
+		return nil
+	}
+
+	sources := []*yaml.Node{merge}
+	if merge.Kind == yaml.SequenceNode {
+		sources = merge.Content
+	}
+	for _, source := range sources {
+		if source.Kind == yaml.AliasNode {
+			source = source.Alias
+		}
+		if value := mappingValue(source, key); value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+// Check if two nodes hold the same data, ignoring comments and style
+func nodesEqual(a, b *yaml.Node) bool {
+	if a.Kind == yaml.AliasNode {
+		a = a.Alias
+	}
+	if b.Kind == yaml.AliasNode {
+		b = b.Alias
+	}
+	if a.Kind != b.Kind || len(a.Content) != len(b.Content) {
+		return false
+	}
+	if a.Kind == yaml.ScalarNode {
+		return a.ShortTag() == b.ShortTag() && a.Value == b.Value
+	}
+	for i := range a.Content {
+		if !nodesEqual(a.Content[i], b.Content[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Join the values of a sequence of scalars, to compare sequences
+func scalarValues(node *yaml.Node) string {
+	values := []string{}
+	for _, item := range node.Content {
+		values = append(values, item.Value)
+	}
+	return strings.Join(values, "\x00")
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SwayKh/linksym/flags"
+	"github.com/SwayKh/linksym/logger"
+)
+
+func init() {
+	flags.CreateFlags(flag.NewFlagSet("test", flag.ContinueOnError))
+	logger.Silence()
+}
+
+const commentedConfig = `# My dotfiles
+version: 1
+init_directory: ~/dotfiles
+
+records:
+    # Shell
+    - id: aaaa
+      paths:
+        - ~/.bashrc
+        - $init_directory/.bashrc
+
+    # Editor, keep in sync with the laptop
+    - id: bbbb
+      paths:
+        - ~/.vimrc # old vim
+        - $init_directory/.vimrc
+
+    - id: cccc # git
+      paths:
+        - ~/.gitconfig
+        - $init_directory/.gitconfig
+# end of records
+`
+
+func TestRemoveRecordKeepsComments(t *testing.T) {
+	tests := []struct {
+		name   string
+		remove []string
+		want   string
+	}{
+		{
+			name:   "nothing",
+			remove: nil,
+			want:   commentedConfig,
+		},
+		{
+			name:   "first record",
+			remove: []string{"aaaa"},
+			want: `# My dotfiles
+version: 1
+init_directory: ~/dotfiles
+
+records:
+    # Editor, keep in sync with the laptop
+    - id: bbbb
+      paths:
+        - ~/.vimrc # old vim
+        - $init_directory/.vimrc
+
+    - id: cccc # git
+      paths:
+        - ~/.gitconfig
+        - $init_directory/.gitconfig
+# end of records
+`,
+		},
+		{
+			name:   "middle record",
+			remove: []string{"bbbb"},
+			want: `# My dotfiles
+version: 1
+init_directory: ~/dotfiles
+
+records:
+    # Shell
+    - id: aaaa
+      paths:
+        - ~/.bashrc
+        - $init_directory/.bashrc
+
+    - id: cccc # git
+      paths:
+        - ~/.gitconfig
+        - $init_directory/.gitconfig
+# end of records
+`,
+		},
+		{
+			name:   "last record",
+			remove: []string{"cccc"},
+			want: `# My dotfiles
+version: 1
+init_directory: ~/dotfiles
+
+records:
+    # Shell
+    - id: aaaa
+      paths:
+        - ~/.bashrc
+        - $init_directory/.bashrc
+
+    # Editor, keep in sync with the laptop
+    - id: bbbb
+      paths:
+        - ~/.vimrc # old vim
+        - $init_directory/.vimrc
+# end of records
+`,
+		},
+		{
+			name:   "two records",
+			remove: []string{"aaaa", "cccc"},
+			want: `# My dotfiles
+version: 1
+init_directory: ~/dotfiles
+
+records:
+    # Editor, keep in sync with the laptop
+    - id: bbbb
+      paths:
+        - ~/.vimrc # old vim
+        - $init_directory/.vimrc
+# end of records
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), ".linksym.yaml")
+			err := os.WriteFile(configPath, []byte(commentedConfig), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			configuration, err := ReadConfig(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range test.remove {
+				configuration.RemoveRecord(id)
+			}
+			err = configuration.WriteConfig("/home/user", "/home/user/dotfiles", configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("Config after removing %v is\n%s\nwant\n%s", test.remove, got, test.want)
+			}
+		})
+	}
+}
+
+func TestBlankLineMarkers(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		want     string
+		restored string
+	}{
+		{
+			name: "blank lines",
+			data: "version: 1\n\nrecords:\n  \n    - id: aaaa\n",
+			want: "version: 1\n" + blankLineMarker + "\nrecords:\n" + blankLineMarker + "\n    - id: aaaa\n",
+			// The spaces on blank lines aren't kept
+			restored: "version: 1\n\nrecords:\n\n    - id: aaaa\n",
+		},
+		{
+			name:     "block scalar",
+			data:     "variables:\n    banner: |\n        hello\n\n        world\n",
+			want:     "variables:\n    banner: |\n        hello\n\n        world\n",
+			restored: "variables:\n    banner: |\n        hello\n\n        world\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			marked := string(markBlankLines([]byte(test.data)))
+			if marked != test.want {
+				t.Errorf("markBlankLines(%q) = %q, want %q", test.data, marked, test.want)
+			}
+			restored := string(restoreBlankLines([]byte(marked)))
+			if restored != test.restored {
+				t.Errorf("restoreBlankLines(%q) = %q, want %q", marked, restored, test.restored)
+			}
+		})
+	}
+}
@@ -1,21 +1,36 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 
+	"github.com/SwayKh/linksym/flags"
 	"github.com/SwayKh/linksym/logger"
 	"gopkg.in/yaml.v3"
 )
 
+var ErrInvalidConfig = errors.New("Invalid config file")
+
 // Load the configuration from .linksym.yaml configuration file and unmarshall
-// it into the AppConfig struct, and return pointer to this struct
+// it into the AppConfig struct, and return pointer to this struct. A config
+// written by an older version is migrated, and written back
 func LoadConfig(configPath string) (*AppConfig, error) {
-	// Check if config file exists
-	logger.VerboseLog(logger.INFO, "Checking if config file exists...")
+	logger.VerboseLog(logger.INFO, "Getting data from config file...")
+	return loadConfig(configPath, true)
+}
 
+// Load the configuration like LoadConfig, without ever writing or logging
+// anything. A config written by an older version is only migrated in memory.
+// Used when the config is read without holding the lock
+func ReadConfig(configPath string) (*AppConfig, error) {
+	return loadConfig(configPath, false)
+}
+
+func loadConfig(configPath string, writeMigration bool) (*AppConfig, error) {
 	config, err := GetFileInfo(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("Error getting File Info of %s: %w", configPath, err)
@@ -34,29 +49,161 @@ func LoadConfig(configPath string) (*AppConfig, error) {
 		return nil, fmt.Errorf("Error reading data from config file: %w", err)
 	}
 
-	logger.VerboseLog(logger.INFO, "Getting data from config file...")
+	indent := detectIndent(data)
+
+	var document yaml.Node
+	err = yaml.Unmarshal(markBlankLines(data), &document)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%w: %s is empty or isn't a YAML mapping", ErrInvalidConfig, filepath.Base(configPath))
+	}
+
+	version, err := configVersion(document.Content[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	err = checkVersion(configPath, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if version < ConfigVersion && writeMigration {
+		data, err = migrateConfig(config.AbsPath, data, &document, version, indent)
+	} else if version < ConfigVersion {
+		data, err = upgradeDocument(config.AbsPath, &document, version, indent)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Unknown keys are an error, instead of being dropped silently when the
+	// config is written back
 	configuration := &AppConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
 
-	err = yaml.Unmarshal(data, &configuration)
+	err = decoder.Decode(configuration)
 	if err != nil {
-		return nil, fmt.Errorf("Error getting data from config file: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
 	}
 
+	// Every command expects records to have a source and a destination path
+	records := mappingValue(document.Content[0], "records")
+	for i, record := range configuration.Records {
+		if len(record.Paths) != 2 {
+			line := 0
+			if records != nil && i < len(records.Content) {
+				line = records.Content[i].Line
+			}
+			return nil, fmt.Errorf("%w: the record on line %d should have 2 paths, but has %d. Run linksym validate to check the config", ErrInvalidConfig, line, len(record.Paths))
+		}
+	}
+
+	configuration.document = &document
+	configuration.indent = indent
 	return configuration, nil
 }
 
-// Write the Configuration struct data to .linksym.yaml file
+// Write the Configuration struct data to .linksym.yaml file. A file written by a
+// newer version of linksym is never overwritten, since its new fields would be
+// lost
 func (configuration *AppConfig) WriteConfig(homeDir, initDir, configPath string) error {
-	data, err := yaml.Marshal(configuration)
+	if existing, err := os.ReadFile(configPath); err == nil {
+		var document yaml.Node
+		if yaml.Unmarshal(existing, &document) == nil && len(document.Content) > 0 {
+			if version, err := configVersion(document.Content[0]); err == nil {
+				if err := checkVersion(configPath, version); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	configuration.Version = ConfigVersion
+
+	var fresh yaml.Node
+	err := fresh.Encode(configuration)
+	if err != nil {
+		return fmt.Errorf("Error marshalling data from configuration{}: %w", err)
+	}
+
+	// Only the parts of the loaded file that changed are replaced
+	document := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&fresh}}
+	indent := 4
+	if configuration.document != nil {
+		configuration.document.Content[0] = mergeNode(configuration.document.Content[0], &fresh)
+		fixAliases(configuration.document)
+		document = configuration.document
+		indent = configuration.indent
+	}
+
+	data, err := encodeDocument(document, indent)
 	if err != nil {
 		return fmt.Errorf("Error marshalling data from configuration{}: %w", err)
 	}
 
+	if *flags.DryRunFlag {
+		logger.Log(logger.INFO, "Would update %s", filepath.Base(configPath))
+		logger.VerboseLog(logger.INFO, "%s", data)
+		logger.Emit(logger.ActionEvent{Action: "config", Path: configPath, DryRun: true})
+		return nil
+	}
+
 	logger.VerboseLog(logger.SUCCESS, "Updating config file...")
 
-	err = os.WriteFile(configPath, data, 0o644)
+	err = WriteFileAtomic(configPath, data, 0o644)
 	if err != nil {
 		return fmt.Errorf("Error writing record to config file: %w", err)
 	}
+	logger.Emit(logger.ActionEvent{Action: "config", Path: configPath})
+	return nil
+}
+
+// Write data to a temporary file next to path, sync it to disk and rename it
+// over path. Either the old or the new contents are found at path if linksym is
+// interrupted, never a truncated file. An existing file keeps its permissions
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(path)
+	file, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tempPath := file.Name()
+
+	// Remove the temporary file, unless it was renamed to path
+	defer os.Remove(tempPath)
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tempPath, perm)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tempPath, path)
+	if err != nil {
+		return err
+	}
+
+	// Sync the directory too, so the rename itself survives a crash
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
 	return nil
 }
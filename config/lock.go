@@ -0,0 +1,95 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrLocked = errors.New("Another linksym instance is running")
+
+// Advisory lock on a file in the state directory, held while linksym loads,
+// changes and writes the config, so two instances can't overwrite each other's
+// changes. The lock is taken with flock, or LockFileEx on Windows, so it's
+// released by the system when the instance holding it exits, even if it was
+// killed
+type Lock struct {
+	Path string
+	file *os.File
+}
+
+// Get the lock for the dotfiles directory containing the config file. The lock
+// file holds the pid and hostname of the instance holding it, to tell the user
+// which instance is running
+func AcquireLock(dir string) (*Lock, error) {
+	err := CreateStateDirectory(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// The lock file is never removed, an instance that opened it before it
+	// was removed could lock it while another locks a new file at the path
+	lockPath := filepath.Join(StateDirectory(dir), "lock")
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening lock file %s: %w", lockPath, err)
+	}
+
+	locked, err := lockFile(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Error locking %s: %w", lockPath, err)
+	}
+	if !locked {
+		file.Close()
+		pid, hostname := readLock(lockPath)
+		if pid > 0 {
+			return nil, fmt.Errorf("%w (pid %d on %s)", ErrLocked, pid, hostname)
+		}
+		return nil, ErrLocked
+	}
+
+	hostname, _ := os.Hostname()
+	err = file.Truncate(0)
+	if err == nil {
+		_, err = file.WriteAt([]byte(fmt.Sprintf("%d\n%s\n", os.Getpid(), hostname)), 0)
+	}
+	if err != nil {
+		unlockFile(file)
+		file.Close()
+		return nil, fmt.Errorf("Error writing lock file %s: %w", lockPath, err)
+	}
+	return &Lock{Path: lockPath, file: file}, nil
+}
+
+// Clear the pid from the lock file and release the lock
+func (l *Lock) Release() error {
+	l.file.Truncate(0)
+
+	err := unlockFile(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Error releasing lock file %s: %w", l.Path, err)
+	}
+	return nil
+}
+
+// Get the pid and hostname written to a lock file
+func readLock(path string) (int, string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, ""
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	pid, _ := strconv.Atoi(lines[0])
+	if len(lines) < 2 {
+		return pid, ""
+	}
+	return pid, lines[1]
+}
@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package config
+
+import "os"
+
+// Files can't be locked on this system, so the lock is always taken
+func lockFile(file *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(file *os.File) error {
+	return nil
+}
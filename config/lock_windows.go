@@ -0,0 +1,31 @@
+//go:build windows
+
+package config
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// The locked byte is far past the end of the file, since other processes can't
+// read locked bytes, and the pid in the file should stay readable
+const lockOffsetHigh = 0x7fffffff
+
+// Take an exclusive lock on the file with LockFileEx, without waiting. Returns
+// false if another process holds it
+func lockFile(file *os.File) (bool, error) {
+	overlapped := windows.Overlapped{OffsetHigh: lockOffsetHigh}
+	flags := uint32(windows.LOCKFILE_EXCLUSIVE_LOCK | windows.LOCKFILE_FAIL_IMMEDIATELY)
+	err := windows.LockFileEx(windows.Handle(file.Fd()), flags, 0, 1, 0, &overlapped)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlockFile(file *os.File) error {
+	overlapped := windows.Overlapped{OffsetHigh: lockOffsetHigh}
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, &overlapped)
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/SwayKh/linksym/flags"
+	"github.com/SwayKh/linksym/logger"
+	"gopkg.in/yaml.v3"
+)
+
+// Version of .linksym.yaml written by this version of linksym. Files without a
+// version key were written before versions existed, and are version 0
+const ConfigVersion = 1
+
+var ErrNewerConfig = errors.New("was written by a newer version of linksym")
+
+// Migrations upgrade a config file by one version, the migration at index i
+// upgrades version i to version i+1. They work on the YAML nodes of the file,
+// since an old file may not decode into the current AppConfig
+var migrations = []func(root *yaml.Node) error{
+	migrateRecordIDs,
+}
+
+// Get the version of a config file from its root mapping node
+func configVersion(root *yaml.Node) (int, error) {
+	node := mappingValue(root, "version")
+	if node == nil {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(node.Value)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("Invalid version %q on line %d", node.Value, node.Line)
+	}
+	return version, nil
+}
+
+// Check that the config file can be read and written by this version of
+// linksym
+func checkVersion(configPath string, version int) error {
+	if version > ConfigVersion {
+		return fmt.Errorf("%s %w (version %d), this version only understands up to version %d. Please upgrade linksym", filepath.Base(configPath), ErrNewerConfig, version, ConfigVersion)
+	}
+	return nil
+}
+
+// Upgrade the document of a config file from an older version to the current
+// one in memory, keeping its comments and formatting. Returns the upgraded file
+func upgradeDocument(configPath string, document *yaml.Node, version, indent int) ([]byte, error) {
+	root := document.Content[0]
+
+	for v := version; v < ConfigVersion; v++ {
+		err := migrations[v](root)
+		if err != nil {
+			return nil, fmt.Errorf("Error migrating %s from version %d to %d: %w", filepath.Base(configPath), v, v+1, err)
+		}
+	}
+	setVersion(root, ConfigVersion)
+
+	migrated, err := encodeDocument(document, indent)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling migrated config: %w", err)
+	}
+	return migrated, nil
+}
+
+// Upgrade the config file at configPath from an older version to the current
+// one. The original file is backed up to the state directory before the
+// upgraded file is written over it. Returns the upgraded file
+func migrateConfig(configPath string, data []byte, document *yaml.Node, version, indent int) ([]byte, error) {
+	migrated, err := upgradeDocument(configPath, document, version, indent)
+	if err != nil {
+		return nil, err
+	}
+
+	if *flags.DryRunFlag {
+		logger.Log(logger.INFO, "Would migrate %s from version %d to %d", filepath.Base(configPath), version, ConfigVersion)
+		return migrated, nil
+	}
+
+	configDir := filepath.Dir(configPath)
+	err = CreateStateDirectory(configDir)
+	if err != nil {
+		return nil, err
+	}
+
+	backupDir := filepath.Join(StateDirectory(configDir), "backups")
+	err = os.MkdirAll(backupDir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create directory %s: %w", backupDir, err)
+	}
+
+	timestamp := time.Now().Format("2006-01-02T15-04-05")
+	backupPath := filepath.Join(backupDir, fmt.Sprintf("%s.v%d-%s", filepath.Base(configPath), version, timestamp))
+	err = WriteFileAtomic(backupPath, data, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("Error backing up %s: %w", filepath.Base(configPath), err)
+	}
+
+	err = WriteFileAtomic(configPath, migrated, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("Error writing migrated config file: %w", err)
+	}
+
+	logger.Log(logger.INFO, "Migrated %s from version %d to %d, the old file is backed up at %s", filepath.Base(configPath), version, ConfigVersion, backupPath)
+	return migrated, nil
+}
+
+// Version 0 to 1: records get a unique ID, which is placed before the other
+// keys of the record
+func migrateRecordIDs(root *yaml.Node) error {
+	records := mappingValue(root, "records")
+	if records == nil || records.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	// Collect the IDs already in use, so new IDs never collide with them
+	existing := &AppConfig{}
+	for _, record := range records.Content {
+		if id := mappingValue(record, "id"); id != nil {
+			existing.Records = append(existing.Records, Record{ID: id.Value})
+		}
+	}
+
+	for _, record := range records.Content {
+		if record.Kind != yaml.MappingNode {
+			return fmt.Errorf("Record on line %d isn't a mapping", record.Line)
+		}
+		if mappingValue(record, "id") != nil {
+			continue
+		}
+
+		id := existing.newRecordID()
+		existing.Records = append(existing.Records, Record{ID: id})
+
+		record.Content = append([]*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "id"},
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: id},
+		}, record.Content...)
+	}
+	return nil
+}
+
+// Set the version key of the root mapping node, adding it as the first key if
+// it's missing
+func setVersion(root *yaml.Node, version int) {
+	value := strconv.Itoa(version)
+	if node := mappingValue(root, "version"); node != nil {
+		node.Value = value
+		node.Tag = "!!int"
+		return
+	}
+
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+
+	// A comment at the top of the file stays at the top
+	if len(root.Content) > 0 {
+		key.HeadComment = root.Content[0].HeadComment
+		root.Content[0].HeadComment = ""
+	}
+
+	root.Content = append([]*yaml.Node{
+		key,
+		{Kind: yaml.ScalarNode, Tag: "!!int", Value: value},
+	}, root.Content...)
+}
+
+// Get the value node of a key in a mapping node, or nil if the key is missing
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
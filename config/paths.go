@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -61,6 +62,63 @@ func ExpandPath(path, homeDir, initDir string) string {
 	return path
 }
 
+// Expand environment variables and the variables of .linksym.yaml in the path.
+// Variables are written as $VAR, ${VAR} or ${VAR:-default}, where the default
+// is used when the variable isn't set or is empty. The variables of the config
+// take priority over the environment, and their values are expanded too, so
+// they can refer to each other. $init_directory is left for ExpandPath
+func ExpandVariables(path string, variables map[string]string) (string, error) {
+	return expandVariables(path, variables, nil)
+}
+
+// Expand the variables in the path. expanding holds the config variables whose
+// values are being expanded, to catch variables that refer to themselves
+func expandVariables(path string, variables map[string]string, expanding []string) (string, error) {
+	var expandErr error
+
+	expanded := os.Expand(path, func(name string) string {
+		name, fallback, hasFallback := strings.Cut(name, ":-")
+		if name == "init_directory" {
+			return "$init_directory"
+		}
+
+		value, ok := variables[name]
+		if ok {
+			if slices.Contains(expanding, name) {
+				if expandErr == nil {
+					expandErr = fmt.Errorf("Variable %s refers to itself: %s", name, strings.Join(append(expanding, name), " -> "))
+				}
+				return ""
+			}
+			var err error
+			value, err = expandVariables(value, variables, append(slices.Clone(expanding), name))
+			if err != nil && expandErr == nil {
+				expandErr = err
+			}
+		} else {
+			value, ok = os.LookupEnv(name)
+		}
+
+		if value == "" && hasFallback {
+			fallback, err := expandVariables(fallback, variables, expanding)
+			if err != nil && expandErr == nil {
+				expandErr = err
+			}
+			return fallback
+		}
+
+		if !ok && expandErr == nil {
+			expandErr = fmt.Errorf("Variable %s in %s isn't set", name, path)
+		}
+		return value
+	})
+
+	if expandErr != nil {
+		return "", expandErr
+	}
+	return expanded, nil
+}
+
 // Create aliases of ~ and $init_directory to make the paths and the
 // configurations more portable
 func AliasPath(path, homeDir, initDir string, aliasToHome bool) string {
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandVariables(t *testing.T) {
+	t.Setenv("LINKSYM_TEST_CONFIG", "/home/user/.config")
+	t.Setenv("LINKSYM_TEST_EMPTY", "")
+
+	variables := map[string]string{
+		"editor":    "nvim",
+		"config":    "${LINKSYM_TEST_UNSET:-~/.config}",
+		"nvim":      "$config/$editor",
+		"override":  "from config",
+		"loop":      "$loop_back",
+		"loop_back": "${loop}",
+		"unset":     "$LINKSYM_TEST_UNSET/x",
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+		// Part of the error message, when the path can't be expanded
+		err string
+	}{
+		{name: "no variables", path: "~/.bashrc", want: "~/.bashrc"},
+		{name: "environment", path: "$LINKSYM_TEST_CONFIG/git", want: "/home/user/.config/git"},
+		{name: "braces", path: "${LINKSYM_TEST_CONFIG}/git", want: "/home/user/.config/git"},
+		{name: "config variable", path: "~/.config/$editor", want: "~/.config/nvim"},
+		{name: "init directory is kept", path: "$init_directory/$editor", want: "$init_directory/nvim"},
+		{name: "default of unset variable", path: "${LINKSYM_TEST_UNSET:-~/.config}/git", want: "~/.config/git"},
+		{name: "default of empty variable", path: "${LINKSYM_TEST_EMPTY:-~/.config}/git", want: "~/.config/git"},
+		{name: "default of set variable", path: "${LINKSYM_TEST_CONFIG:-~/.config}/git", want: "/home/user/.config/git"},
+		{name: "variable in default", path: "${LINKSYM_TEST_UNSET:-~/$editor}", want: "~/nvim"},
+		{name: "value with default", path: "$config/git", want: "~/.config/git"},
+		{name: "nested values", path: "$nvim/init.lua", want: "~/.config/nvim/init.lua"},
+		{name: "unset variable", path: "$LINKSYM_TEST_UNSET/git", err: "Variable LINKSYM_TEST_UNSET in $LINKSYM_TEST_UNSET/git isn't set"},
+		{name: "unset variable in value", path: "~/$unset", err: "Variable LINKSYM_TEST_UNSET in $LINKSYM_TEST_UNSET/x isn't set"},
+		{name: "cycle", path: "~/$loop", err: "Variable loop refers to itself: loop -> loop_back -> loop"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ExpandVariables(test.path, variables)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("ExpandVariables(%q) = %q, %v, want error %q", test.path, got, err, test.err)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("ExpandVariables(%q) = %q, %v, want %q", test.path, got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestExpandRecordPath(t *testing.T) {
+	configuration := &AppConfig{Variables: map[string]string{
+		"relative": "dotfiles",
+		"config":   "~/.config",
+	}}
+
+	tests := []struct {
+		path string
+		want string
+		err  bool
+	}{
+		{path: "~/.bashrc", want: "/home/user/.bashrc"},
+		{path: "$init_directory/.bashrc", want: "/home/user/dotfiles/.bashrc"},
+		{path: "/etc/hosts", want: "/etc/hosts"},
+		{path: "$config/git", want: "/home/user/.config/git"},
+		{path: ".bashrc", err: true},
+		{path: "$relative/.bashrc", err: true},
+	}
+
+	for _, test := range tests {
+		got, err := configuration.ExpandRecordPath(test.path, "/home/user", "/home/user/dotfiles")
+		if test.err {
+			if err == nil {
+				t.Errorf("ExpandRecordPath(%q) = %q, want an error", test.path, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("ExpandRecordPath(%q) = %q, %v, want %q", test.path, got, err, test.want)
+		}
+	}
+}
+
+func TestUnAliasConfigSkipsUnexpandedRecords(t *testing.T) {
+	configuration := &AppConfig{
+		InitDirectory: "~/dotfiles",
+		Records: []Record{
+			{ID: "aaaa", Paths: []string{"~/.bashrc", "$init_directory/.bashrc"}},
+			{ID: "bbbb", Paths: []string{"$LINKSYM_TEST_UNSET/.vimrc", "$init_directory/.vimrc"}},
+		},
+	}
+	configuration.UnAliasConfig("/home/user", "/home/user/dotfiles")
+
+	valid, invalid := configuration.Records[0], configuration.Records[1]
+	if valid.PathError() != nil || valid.Paths[0] != "/home/user/.bashrc" {
+		t.Errorf("Record aaaa has paths %v and error %v, want it expanded", valid.Paths, valid.PathError())
+	}
+	if invalid.PathError() == nil || invalid.Paths[0] != "$LINKSYM_TEST_UNSET/.vimrc" {
+		t.Errorf("Record bbbb has paths %v and error %v, want it kept as written", invalid.Paths, invalid.PathError())
+	}
+
+	matches, reason, err := invalid.Matches(Machine{}, "/home/user", "/home/user/dotfiles")
+	if matches || reason == "" || err != nil {
+		t.Errorf("Record bbbb matches = %v, %q, %v, want it skipped", matches, reason, err)
+	}
+
+	// The record is written back as it was
+	configuration.AliasConfig("/home/user", "/home/user/dotfiles")
+	if invalid := configuration.Records[1]; invalid.Paths[0] != "$LINKSYM_TEST_UNSET/.vimrc" {
+		t.Errorf("Record bbbb is written with paths %v, want them as written", invalid.Paths)
+	}
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/SwayKh/linksym/logger"
+)
+
+var (
+	ErrRecordNotFound = errors.New("No record found")
+	ErrAmbiguous      = errors.New("matches multiple records")
+	ErrDuplicate      = errors.New("Record already exists")
+)
+
+// Name of the record if it has one, otherwise its ID
+func (r Record) Label() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.ID
+}
+
+// Mode of the record, records without one are symlinks
+func (r Record) LinkMode() string {
+	if r.Mode == "" {
+		return ModeSymlink
+	}
+	return r.Mode
+}
+
+// Get the record as an event for the JSON output, with its paths expanded
+func (r Record) Event() logger.RecordEvent {
+	event := logger.RecordEvent{ID: r.ID, Name: r.Name, Tags: r.Tags, Mode: r.LinkMode()}
+	if len(r.Paths) == 2 {
+		event.Source, event.Destination = r.Paths[0], r.Paths[1]
+	}
+	return event
+}
+
+// Check if the record has the tag
+func (r Record) HasTag(tag string) bool {
+	return slices.Contains(r.Tags, tag)
+}
+
+// Check that a mode of a record is one linksym knows
+func ValidateMode(mode string) error {
+	switch mode {
+	case ModeSymlink, ModeTemplate, ModeCopy, ModeHardlink:
+		return nil
+	default:
+		return fmt.Errorf("Invalid mode %q. Valid modes are symlink, template, copy and hardlink", mode)
+	}
+}
+
+// Check if the symlink of the record should be relative, either set for the
+// record itself or for the whole config
+func (c *AppConfig) IsRelative(record Record) bool {
+	if record.Relative != nil {
+		return *record.Relative
+	}
+	return c.Relative
+}
+
+// Find the record matching the query, which can be the ID of the record, its
+// name, the symlink path or the path of the file in the init directory. If the
+// query matches more than one record, the error lists all of them
+func (c *AppConfig) FindRecord(query string) (*Record, error) {
+	absPath, err := filepath.Abs(query)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting absolute path of %s: %w", query, err)
+	}
+
+	// IDs are unique, but a name or path of another record can still be the
+	// same as an ID, which makes the query ambiguous too
+	matches := []int{}
+	for i, record := range c.Records {
+		if record.ID == query || (record.Name != "" && record.Name == query) || record.hasPath(absPath) {
+			matches = append(matches, i)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w for %s", ErrRecordNotFound, query)
+	case 1:
+		return &c.Records[matches[0]], nil
+	}
+
+	// When the query is an ID itself, only the paths tell the records apart
+	use := "IDs"
+	candidates := []string{}
+	for _, i := range matches {
+		record := c.Records[i]
+		if record.ID == query {
+			use = "paths"
+		}
+		candidates = append(candidates, fmt.Sprintf("  %-8s  %s", record.ID, strings.Join(record.Paths, " -> ")))
+	}
+	return nil, fmt.Errorf("%s %w, use one of their %s:\n%s", query, ErrAmbiguous, use, strings.Join(candidates, "\n"))
+}
+
+// Get the record with the ID, or nil if there's none
+func (c *AppConfig) RecordByID(id string) *Record {
+	for i := range c.Records {
+		if c.Records[i].ID == id {
+			return &c.Records[i]
+		}
+	}
+	return nil
+}
+
+// Check that a new record with these paths and name wouldn't duplicate an
+// existing record. Called before any file is moved, so nothing has to be undone
+func (c *AppConfig) CheckNewRecord(sourcePath, destinationPath, name string) error {
+	for _, record := range c.Records {
+		switch {
+		case name != "" && record.Name == name:
+			return fmt.Errorf("%w with the name %s (%s)", ErrDuplicate, name, record.ID)
+		case name != "" && record.ID == name:
+			return fmt.Errorf("%w with the ID %s, which can't be used as a name", ErrDuplicate, name)
+		case record.hasPath(sourcePath):
+			return fmt.Errorf("%w for %s (%s)", ErrDuplicate, sourcePath, record.Label())
+		case record.hasPath(destinationPath):
+			return fmt.Errorf("%w for %s (%s)", ErrDuplicate, destinationPath, record.Label())
+		}
+	}
+	return nil
+}
+
+// Give every record without an ID a new one. Returns true if any record was
+// changed
+func (c *AppConfig) AssignRecordIDs() bool {
+	changed := false
+	for i := range c.Records {
+		if c.Records[i].ID == "" {
+			c.Records[i].ID = c.newRecordID()
+			logger.VerboseLog(logger.INFO, "Assigning ID %s to record %s", c.Records[i].ID, c.Records[i].Name)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Check if either path of the record is the given absolute path
+func (r Record) hasPath(path string) bool {
+	for _, recordPath := range r.Paths {
+		if filepath.Clean(recordPath) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Generate a random 8 character ID, which isn't used by any record yet
+func (c *AppConfig) newRecordID() string {
+	for {
+		buf := make([]byte, 4)
+		rand.Read(buf)
+		id := hex.EncodeToString(buf)
+
+		// Names are matched like IDs, so the ID can't be a name either
+		unique := true
+		for _, record := range c.Records {
+			if record.ID == id || record.Name == id {
+				unique = false
+				break
+			}
+		}
+		if unique {
+			return id
+		}
+	}
+}
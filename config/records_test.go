@@ -0,0 +1,40 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNamesCantBeIDs(t *testing.T) {
+	configuration := &AppConfig{Records: []Record{
+		{ID: "aaaa", Name: "shell", Paths: []string{"/home/user/.bashrc", "/home/user/dotfiles/.bashrc"}},
+		{ID: "bbbb", Name: "aaaa", Paths: []string{"/home/user/.vimrc", "/home/user/dotfiles/.vimrc"}},
+	}}
+
+	err := configuration.CheckNewRecord("/home/user/.gitconfig", "/home/user/dotfiles/.gitconfig", "bbbb")
+	if !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Adding a record named after the ID bbbb returned %v, want %v", err, ErrDuplicate)
+	}
+	err = configuration.CheckNewRecord("/home/user/.gitconfig", "/home/user/dotfiles/.gitconfig", "shell")
+	if !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Adding a second record named shell returned %v, want %v", err, ErrDuplicate)
+	}
+	err = configuration.CheckNewRecord("/home/user/.gitconfig", "/home/user/dotfiles/.gitconfig", "git")
+	if err != nil {
+		t.Errorf("Adding a record named git returned %v", err)
+	}
+
+	// The ID of one record and the name of another
+	_, err = configuration.FindRecord("aaaa")
+	if !errors.Is(err, ErrAmbiguous) {
+		t.Errorf("Finding aaaa returned %v, want %v", err, ErrAmbiguous)
+	}
+	record, err := configuration.FindRecord("bbbb")
+	if err != nil || record.ID != "bbbb" {
+		t.Errorf("Finding bbbb returned %v, %v, want record bbbb", record, err)
+	}
+	record, err = configuration.FindRecord("/home/user/.vimrc")
+	if err != nil || record.ID != "bbbb" {
+		t.Errorf("Finding /home/user/.vimrc returned %v, %v, want record bbbb", record, err)
+	}
+}
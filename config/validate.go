@@ -0,0 +1,400 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severity of a problem found in the config. Errors break linksym commands,
+// warnings are worth fixing but don't
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// A problem found in the config file, at the line and column of the node it's
+// about, with a suggestion for fixing it
+type Diagnostic struct {
+	File     string
+	Line     int
+	Column   int
+	Severity Severity
+	Message  string
+	Fix      string
+}
+
+func (d Diagnostic) String() string {
+	position := d.File
+	if d.Line > 0 {
+		position += fmt.Sprintf(":%d", d.Line)
+	}
+	if d.Column > 0 {
+		position += fmt.Sprintf(":%d", d.Column)
+	}
+
+	s := fmt.Sprintf("%s: %s: %s", position, d.Severity, d.Message)
+	if d.Fix != "" {
+		s += "\n    fix: " + d.Fix
+	}
+	return s
+}
+
+// Matches the line number in the errors of the YAML parser and decoder
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// Check the config file at configPath for every problem linksym can find
+// without changing anything, and return them in the order of the file. The
+// config file is read as it is, without migrating it. Conflict policies are
+// defined in the link package, so checkPolicy is given by the caller
+func Validate(configPath, homeDir string, checkPolicy func(string) error) ([]Diagnostic, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %w", configPath, err)
+	}
+
+	v := &validator{file: displayPath(configPath), homeDir: homeDir}
+
+	var document yaml.Node
+	err = yaml.Unmarshal(data, &document)
+	if err != nil {
+		v.parseError(err, "Fix the YAML syntax")
+		return v.diagnostics, nil
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		v.add(&document, SeverityError, "The config file is empty or isn't a YAML mapping", "Run linksym init to create a new config file")
+		return v.diagnostics, nil
+	}
+	root := document.Content[0]
+
+	// Wrong types are reported by the decoder. Unknown keys are reported by
+	// checkKeys, with a suggestion
+	configuration := &AppConfig{}
+	err = root.Decode(configuration)
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		for _, message := range typeErr.Errors {
+			v.parseError(errors.New(message), "Change the value to the type linksym expects")
+		}
+	} else if err != nil {
+		v.parseError(err, "")
+	}
+
+	v.checkVersion(root, configPath)
+	v.checkKeys(root, AppConfig{}, "")
+
+	initDir := filepath.Dir(configPath)
+	if node := mappingValue(root, "init_directory"); node == nil {
+		v.add(root, SeverityError, "Missing init_directory", "Run linksym update to set it to the directory of the config file")
+	} else if dir := ExpandPath(node.Value, homeDir, node.Value); dir != initDir {
+		v.add(node, SeverityWarning, fmt.Sprintf("init_directory is %s, but the config file is in %s", AliasPath(dir, homeDir, dir, true), AliasPath(initDir, homeDir, initDir, true)), "Run linksym update if the dotfiles directory was moved")
+	}
+
+	if node := mappingValue(root, "layout"); node != nil {
+		switch node.Value {
+		case LayoutFlat, LayoutMirror:
+		default:
+			v.add(node, SeverityError, fmt.Sprintf("Invalid layout %q", node.Value), "Use flat or mirror")
+		}
+	}
+
+	if node := mappingValue(root, "on_conflict"); node != nil && checkPolicy != nil {
+		if err := checkPolicy(node.Value); err != nil {
+			v.add(node, SeverityError, err.Error(), "")
+		}
+	}
+
+	records := mappingValue(root, "records")
+	if records == nil {
+		v.add(root, SeverityWarning, "Missing records", "Add records with linksym add")
+		return v.diagnostics, nil
+	}
+	if records.Kind != yaml.SequenceNode {
+		v.add(records, SeverityError, "records isn't a list", "Make records a list of records, or an empty list []")
+		return v.diagnostics, nil
+	}
+
+	v.checkRecords(records, configuration, initDir)
+
+	slices.SortStableFunc(v.diagnostics, func(a, b Diagnostic) int {
+		return a.Line - b.Line
+	})
+	return v.diagnostics, nil
+}
+
+type validator struct {
+	file        string
+	homeDir     string
+	diagnostics []Diagnostic
+}
+
+func (v *validator) add(node *yaml.Node, severity Severity, message, fix string) {
+	v.diagnostics = append(v.diagnostics, Diagnostic{
+		File:     v.file,
+		Line:     node.Line,
+		Column:   node.Column,
+		Severity: severity,
+		Message:  message,
+		Fix:      fix,
+	})
+}
+
+// Add an error of the YAML parser or decoder, which only know the line
+func (v *validator) parseError(err error, fix string) {
+	diagnostic := Diagnostic{File: v.file, Severity: SeverityError, Message: err.Error(), Fix: fix}
+	if match := yamlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+		diagnostic.Line, _ = strconv.Atoi(match[1])
+		diagnostic.Message = match[2]
+	}
+	v.diagnostics = append(v.diagnostics, diagnostic)
+}
+
+func (v *validator) checkVersion(root *yaml.Node, configPath string) {
+	node := mappingValue(root, "version")
+	version, err := configVersion(root)
+	switch {
+	case err != nil:
+		v.add(node, SeverityError, err.Error(), fmt.Sprintf("Set version to %d", ConfigVersion))
+	case checkVersion(configPath, version) != nil:
+		v.add(node, SeverityError, fmt.Sprintf("Version %d is newer than this version of linksym understands", version), "Upgrade linksym")
+	case version < ConfigVersion && node == nil:
+		v.add(root, SeverityWarning, "The config file has no version, and will be upgraded", "Run linksym update to upgrade it")
+	case version < ConfigVersion:
+		v.add(node, SeverityWarning, fmt.Sprintf("Version %d is old, and will be upgraded", version), "Run linksym update to upgrade it")
+	}
+}
+
+// Report keys of a mapping that aren't fields of the struct it's decoded into
+func (v *validator) checkKeys(node *yaml.Node, value any, context string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+
+	known := yamlKeys(value)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if key.Value == "<<" || slices.Contains(known, key.Value) {
+			continue
+		}
+
+		fix := "Remove it"
+		if suggestion := closestKey(key.Value, known); suggestion != "" {
+			fix = fmt.Sprintf("Did you mean %s?", suggestion)
+		}
+		v.add(key, SeverityError, fmt.Sprintf("Unknown key %q%s", key.Value, context), fix)
+	}
+}
+
+func (v *validator) checkRecords(records *yaml.Node, configuration *AppConfig, initDir string) {
+	ids := map[string]*yaml.Node{}
+	names := map[string]*yaml.Node{}
+	paths := map[string]*yaml.Node{}
+	// The records of the IDs and names, since a name can't be the ID of another
+	// record
+	idRecords := map[string]*yaml.Node{}
+	nameRecords := map[string]*yaml.Node{}
+
+	for i, node := range records.Content {
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		if node.Kind != yaml.MappingNode {
+			v.add(node, SeverityError, fmt.Sprintf("Record %d isn't a mapping", i+1), "Give the record an id and paths")
+			continue
+		}
+
+		recordName := strconv.Itoa(i + 1)
+		if name := mappingValue(node, "name"); name != nil && name.Value != "" {
+			recordName = name.Value
+		} else if id := mappingValue(node, "id"); id != nil && id.Value != "" {
+			recordName = id.Value
+		}
+		label := "Record " + recordName
+
+		v.checkKeys(node, Record{}, " in record "+recordName)
+		if when := mappingValue(node, "when"); when != nil {
+			v.checkKeys(resolveAlias(when), Conditions{}, " in the conditions of record "+recordName)
+			v.checkConditions(resolveAlias(when), label)
+		}
+
+		if id := mappingValue(node, "id"); id == nil || id.Value == "" {
+			v.add(node, SeverityWarning, label+" has no ID", "Run linksym update to give it one")
+		} else if first, ok := ids[id.Value]; ok {
+			v.add(id, SeverityError, fmt.Sprintf("%s has the same ID as the record on line %d", label, first.Line), "Remove the id, and run linksym update to give the record a new one")
+		} else {
+			ids[id.Value] = id
+			idRecords[id.Value] = node
+			if name, ok := names[id.Value]; ok && nameRecords[id.Value] != node {
+				v.add(id, SeverityError, fmt.Sprintf("%s has an ID that's the name of the record on line %d", label, name.Line), "Rename the record on line "+strconv.Itoa(name.Line))
+			}
+		}
+
+		if name := mappingValue(node, "name"); name != nil && name.Value != "" {
+			if first, ok := names[name.Value]; ok {
+				v.add(name, SeverityError, fmt.Sprintf("%s has the same name as the record on line %d", label, first.Line), "Rename one of the records")
+			} else {
+				names[name.Value] = name
+				nameRecords[name.Value] = node
+			}
+			if id, ok := ids[name.Value]; ok && idRecords[name.Value] != node {
+				v.add(name, SeverityError, fmt.Sprintf("%s has the ID of the record on line %d as its name", label, id.Line), "Rename the record")
+			}
+		}
+
+		mode := ModeSymlink
+		if modeNode := mappingValue(node, "mode"); modeNode != nil {
+			mode = modeNode.Value
+			if err := ValidateMode(mode); err != nil {
+				v.add(modeNode, SeverityError, err.Error(), "")
+			}
+		}
+
+		pathsNode := mappingValue(node, "paths")
+		if pathsNode == nil {
+			v.add(node, SeverityError, label+" has no paths", "Add the path in the home directory and the path in the dotfiles directory")
+			continue
+		}
+		pathsNode = resolveAlias(pathsNode)
+		if pathsNode.Kind != yaml.SequenceNode || len(pathsNode.Content) != 2 {
+			v.add(pathsNode, SeverityError, fmt.Sprintf("%s should have 2 paths, but has %d", label, len(pathsNode.Content)), "Give the path in the home directory first, then the path in the dotfiles directory")
+			continue
+		}
+
+		expanded := []string{}
+		for _, path := range pathsNode.Content {
+			if path.Kind != yaml.ScalarNode || path.Value == "" {
+				v.add(path, SeverityError, label+" has an empty or invalid path", "Use a path like ~/.bashrc or $init_directory/.bashrc")
+				break
+			}
+
+			expandedPath, err := configuration.ExpandRecordPath(path.Value, v.homeDir, initDir)
+			if err != nil {
+				v.add(path, SeverityError, fmt.Sprintf("%s: %s", label, err), "Define the variable in variables, or give it a default with ${NAME:-default}, and start the path with ~, / or $init_directory")
+				break
+			}
+			expanded = append(expanded, expandedPath)
+		}
+		if len(expanded) != 2 {
+			continue
+		}
+
+		// Records that only apply to some machines can share a path with
+		// records for other machines
+		conditional := mappingValue(node, "when") != nil
+		for j, path := range expanded {
+			if first, ok := paths[path]; ok && !conditional {
+				v.add(pathsNode.Content[j], SeverityError, fmt.Sprintf("%s has the same path %s as the record on line %d", label, AliasPath(path, v.homeDir, initDir, false), first.Line), "Remove one of the records, or limit them to different machines with when")
+			} else if !ok {
+				paths[path] = pathsNode.Content[j]
+			}
+		}
+
+		source, destination := expanded[0], expanded[1]
+		if !isInside(source, v.homeDir) {
+			v.add(pathsNode.Content[0], SeverityWarning, fmt.Sprintf("%s links %s, which is outside the home directory", label, source), "Use a path in the home directory, or ignore this if it's intended")
+		}
+		if !isInside(destination, initDir) {
+			v.add(pathsNode.Content[1], SeverityWarning, fmt.Sprintf("%s keeps its file at %s, outside the dotfiles directory", label, AliasPath(destination, v.homeDir, initDir, true)), "Move the file into the dotfiles directory, and use $init_directory in the path")
+		} else if _, err := os.Lstat(destination); errors.Is(err, os.ErrNotExist) {
+			fix := "Restore the file, or remove the record with linksym remove"
+			if mode == ModeCopy {
+				fix = "Restore the file, run linksym pull, or remove the record with linksym remove"
+			}
+			v.add(pathsNode.Content[1], SeverityError, fmt.Sprintf("%s: %s doesn't exist", label, AliasPath(destination, v.homeDir, initDir, false)), fix)
+		}
+	}
+}
+
+func (v *validator) checkConditions(when *yaml.Node, label string) {
+	hosts := resolveAlias(mappingValue(when, "hosts"))
+	if hosts == nil {
+		return
+	}
+	for _, host := range hosts.Content {
+		if _, err := filepath.Match(host.Value, ""); err != nil {
+			v.add(host, SeverityError, fmt.Sprintf("%s has an invalid host pattern %q", label, host.Value), "Fix the glob pattern, like work-* or laptop")
+		}
+	}
+}
+
+// Get the node an alias points to, or the node itself
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	if node != nil && node.Kind == yaml.AliasNode {
+		return node.Alias
+	}
+	return node
+}
+
+// Get the YAML keys of the fields of a struct
+func yamlKeys(value any) []string {
+	keys := []string{}
+	t := reflect.TypeOf(value)
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("yaml")
+		if name, _, _ := strings.Cut(tag, ","); name != "" && name != "-" {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
+
+// Get the known key closest to a misspelled key, or an empty string if none
+// is close enough
+func closestKey(key string, known []string) string {
+	closest, best := "", 3
+	for _, candidate := range known {
+		if distance := editDistance(key, candidate); distance < best {
+			closest, best = candidate, distance
+		}
+	}
+	return closest
+}
+
+// Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// Check if path is dir or inside it
+func isInside(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Path of the config file relative to the current directory when it's inside
+// it, like editors and other linters show them
+func displayPath(path string) string {
+	cwd, err := os.Getwd()
+	if err == nil && isInside(path, cwd) {
+		if rel, err := filepath.Rel(cwd, path); err == nil {
+			return rel
+		}
+	}
+	return path
+}
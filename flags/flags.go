@@ -11,12 +11,40 @@ import (
 var (
 	HelpFlag    *bool
 	VerboseFlag *bool
+	DryRunFlag  *bool
+
+	OnConflictFlag *string
+	ConfigFlag     *string
+	HostFlag       *string
+	OSFlag         *string
+	OutputFlag     *string
 )
 
-// Setup the Flags for the CLI
-func CreateFlags() {
-	// Handle both -h and --help with one boolean
-	HelpFlag = flag.Bool("h", false, "Show help")
-	flag.BoolVar(HelpFlag, "help", false, "Show help")
-	VerboseFlag = flag.Bool("v", false, "Verbose output")
+// Setup the global Flags of the CLI on a FlagSet. The global flags are defined
+// on the FlagSet of every subcommand too, so they can be given anywhere on the
+// command line. They always point to the same values, and a value that was
+// already parsed is kept as the default of the next FlagSet
+func CreateFlags(flagSet *flag.FlagSet) {
+	if HelpFlag == nil {
+		HelpFlag, VerboseFlag, DryRunFlag = new(bool), new(bool), new(bool)
+		OnConflictFlag, ConfigFlag, HostFlag, OSFlag = new(string), new(string), new(string), new(string)
+		OutputFlag = new(string)
+		*OutputFlag = "text"
+	}
+
+	// Handle both -h and --help with one boolean. The usages are shown in help
+	// and the man page
+	flagSet.BoolVar(HelpFlag, "h", *HelpFlag, "Display this help message")
+	flagSet.BoolVar(HelpFlag, "help", *HelpFlag, "Display this help message")
+	flagSet.BoolVar(VerboseFlag, "v", *VerboseFlag, "Show verbose output")
+	// Handle both -n and --dry-run with one boolean
+	flagSet.BoolVar(DryRunFlag, "n", *DryRunFlag, "Print every change a command would make, without changing anything")
+	flagSet.BoolVar(DryRunFlag, "dry-run", *DryRunFlag, "Print every change a command would make, without changing anything")
+	flagSet.StringVar(OnConflictFlag, "on-conflict", *OnConflictFlag, "How to handle an existing file where a file is moved or a symlink is created. The `policy` is fail, backup, overwrite or prompt, and defaults to backup")
+	// Handle both -C and --config with one string
+	flagSet.StringVar(ConfigFlag, "C", *ConfigFlag, "Use the .linksym.yaml in this `directory`, or the config file at this path, instead of finding it")
+	flagSet.StringVar(ConfigFlag, "config", *ConfigFlag, "Use the .linksym.yaml in this `directory`, or the config file at this path, instead of finding it")
+	flagSet.StringVar(HostFlag, "host", *HostFlag, "Evaluate the conditions of records as if running on this `hostname`")
+	flagSet.StringVar(OSFlag, "os", *OSFlag, "Evaluate the conditions of records as if running on this operating system")
+	flagSet.StringVar(OutputFlag, "output", *OutputFlag, "With json, write the results of the command to stdout as JSON lines, and the logs and help to stderr. The `format` is text or json, and defaults to text")
 }
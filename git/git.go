@@ -0,0 +1,200 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var ErrNotRepository = errors.New("not in a git repository")
+
+// State of a file in the git repository, as shown by linksym status --git
+type FileState string
+
+const (
+	StateClean     FileState = "clean"
+	StateModified  FileState = "modified"
+	StateUntracked FileState = "untracked"
+	StateIgnored   FileState = "ignored"
+)
+
+// Run the git binary in a directory, and return its output. Errors include
+// what git printed to stderr
+func run(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", fmt.Errorf("git isn't installed: %w", err)
+	} else if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return "", fmt.Errorf("git %s failed: %s", args[0], message)
+	}
+	return stdout.String(), nil
+}
+
+// Get the root of the git repository the directory is in
+func TopLevel(dir string) (string, error) {
+	output, err := run(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("%s is %w", dir, ErrNotRepository)
+	}
+	return filepath.Clean(strings.TrimSpace(output)), nil
+}
+
+// Stage the paths and commit them with the message, leaving everything else
+// that's staged alone. Paths that don't exist and aren't tracked, and ignored
+// paths are skipped. Returns false if none of the paths changed, and nothing
+// was committed
+func Commit(dir string, paths []string, message string) (bool, error) {
+	root, err := TopLevel(dir)
+	if err != nil {
+		return false, err
+	}
+
+	output, err := run(root, append([]string{"ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--directory", "--"}, paths...)...)
+	if err != nil {
+		return false, err
+	}
+	ignored := []string{}
+	for _, path := range strings.Split(output, "\x00") {
+		if path != "" {
+			ignored = append(ignored, filepath.Join(root, path))
+		}
+	}
+
+	// Deleted files are staged too, but git refuses paths it doesn't know
+	pathspecs := []string{}
+	for _, path := range paths {
+		if isIgnored(path, ignored) {
+			continue
+		}
+		if _, err := os.Lstat(path); err == nil {
+			pathspecs = append(pathspecs, path)
+			continue
+		}
+		tracked, err := run(root, "ls-files", "--", path)
+		if err != nil {
+			return false, err
+		}
+		if tracked != "" {
+			pathspecs = append(pathspecs, path)
+		}
+	}
+	if len(pathspecs) == 0 {
+		return false, nil
+	}
+
+	_, err = run(root, append([]string{"add", "--all", "--"}, pathspecs...)...)
+	if err != nil {
+		return false, err
+	}
+
+	staged, err := run(root, append([]string{"diff", "--cached", "--name-only", "--"}, pathspecs...)...)
+	if err != nil {
+		return false, err
+	}
+	if staged == "" {
+		return false, nil
+	}
+
+	_, err = run(root, append([]string{"commit", "--quiet", "--message", message, "--"}, pathspecs...)...)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Check if the path, or a directory it's in, is one of the ignored paths
+func isIgnored(path string, ignored []string) bool {
+	for _, ignoredPath := range ignored {
+		if path == ignoredPath || strings.HasPrefix(path, ignoredPath+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Changed, untracked and ignored paths of a repository, as listed by git
+// status
+type Status struct {
+	entries []statusEntry
+}
+
+type statusEntry struct {
+	path  string
+	state FileState
+	// Ignored directories are listed without the files in them
+	isDir bool
+}
+
+// Get the status of every file in the git repository the directory is in
+func GetStatus(dir string) (*Status, error) {
+	root, err := TopLevel(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := run(root, "status", "--porcelain", "-z", "--ignored", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{}
+	fields := strings.Split(output, "\x00")
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if len(field) < 4 {
+			continue
+		}
+
+		code, path := field[:2], field[3:]
+		entry := statusEntry{
+			path:  filepath.Join(root, path),
+			state: StateModified,
+			isDir: strings.HasSuffix(path, "/"),
+		}
+		switch code {
+		case "??":
+			entry.state = StateUntracked
+		case "!!":
+			entry.state = StateIgnored
+		}
+		// Renames and copies are followed by the path they came from
+		if code[0] == 'R' || code[0] == 'C' {
+			i++
+		}
+		status.entries = append(status.entries, entry)
+	}
+	return status, nil
+}
+
+// Get the state of a file or directory. A directory is modified or untracked
+// if any file in it is, and ignored only if the whole directory is
+func (s *Status) State(path string) FileState {
+	state := StateClean
+	for _, entry := range s.entries {
+		inPath := entry.path == path || strings.HasPrefix(entry.path, path+string(filepath.Separator))
+		inEntry := entry.isDir && strings.HasPrefix(path, entry.path+string(filepath.Separator))
+
+		switch {
+		case entry.state == StateModified && inPath:
+			return StateModified
+		case entry.state == StateUntracked && inPath:
+			state = StateUntracked
+		case entry.state == StateIgnored && (entry.path == path || inEntry) && state == StateClean:
+			state = StateIgnored
+		}
+	}
+	return state
+}
@@ -0,0 +1,152 @@
+package link
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/flags"
+	"github.com/SwayKh/linksym/logger"
+)
+
+var ErrExists = errors.New("already exists")
+
+// What to do with a file that already exists where linksym needs to move a file
+// or create a symlink
+type ConflictPolicy string
+
+const (
+	ConflictFail      ConflictPolicy = "fail"
+	ConflictBackup    ConflictPolicy = "backup"
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	ConflictPrompt    ConflictPolicy = "prompt"
+
+	DefaultConflictPolicy = ConflictBackup
+)
+
+// Get the ConflictPolicy for the value of the --on-conflict flag or the
+// on_conflict field in .linksym.yaml. An empty value returns the default policy
+func ParseConflictPolicy(value string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(value); policy {
+	case "":
+		return DefaultConflictPolicy, nil
+	case ConflictFail, ConflictBackup, ConflictOverwrite, ConflictPrompt:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("Invalid conflict policy %q. Valid policies are fail, backup, overwrite and prompt", value)
+	}
+}
+
+// Handle an existing file or directory at path, which is about to be replaced,
+// based on the conflict policy. Returns an error if the file should be kept
+// and the current operation aborted
+func (paths LinkPaths) resolveConflict(path string) error {
+	_, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Error getting file info of %s: %w", path, err)
+	}
+
+	aliasPath := config.AliasPath(path, paths.HomeDir, paths.InitDir, true)
+
+	policy := paths.Conflict
+	if policy == "" {
+		policy = DefaultConflictPolicy
+	}
+
+	if policy == ConflictPrompt {
+		if *flags.DryRunFlag {
+			logger.Log(logger.WARNING, "Would ask what to do with existing %s", aliasPath)
+			return nil
+		}
+		policy, err = promptConflict(aliasPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch policy {
+	case ConflictBackup:
+		return paths.backupFile(path)
+	case ConflictOverwrite:
+		return deleteFile(path, paths.HomeDir, paths.InitDir)
+	default:
+		return fmt.Errorf("%s %w. Use --on-conflict backup or overwrite to replace it", aliasPath, ErrExists)
+	}
+}
+
+// Ask the user whether to back up, overwrite or keep an existing file
+func promptConflict(aliasPath string) (ConflictPolicy, error) {
+	reader := bufio.NewReader(os.Stdin)
+
+	for {
+		logger.Log(logger.WARNING, "%s already exists. [b]ackup, [o]verwrite or [a]bort?", aliasPath)
+
+		answer, err := reader.ReadString('\n')
+		if err != nil && answer == "" {
+			return ConflictFail, nil
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "b", "backup":
+			return ConflictBackup, nil
+		case "o", "overwrite":
+			return ConflictOverwrite, nil
+		case "a", "abort":
+			return ConflictFail, nil
+		}
+	}
+}
+
+// Move the file at path to the backup directory of this invocation, keeping
+// its path relative to the home directory, so it can be found and restored. A
+// path backed up more than once in the same invocation gets a numbered suffix,
+// .1, .2 and so on, so an earlier backup is never replaced
+func (paths LinkPaths) backupFile(path string) error {
+	if paths.BackupDir == "" {
+		return fmt.Errorf("No backup directory set, can't back up %s", path)
+	}
+
+	relativePath, err := filepath.Rel(paths.HomeDir, path)
+	if err != nil || strings.HasPrefix(relativePath, "..") {
+		relativePath = strings.TrimPrefix(path, string(os.PathSeparator))
+	}
+	backupPath := filepath.Join(paths.BackupDir, relativePath)
+	for i := 1; exists(backupPath); i++ {
+		backupPath = fmt.Sprintf("%s.%d", filepath.Join(paths.BackupDir, relativePath), i)
+	}
+
+	aliasPath := config.AliasPath(path, paths.HomeDir, paths.InitDir, true)
+	aliasBackupPath := config.AliasPath(backupPath, paths.HomeDir, paths.InitDir, true)
+
+	if *flags.DryRunFlag {
+		logger.Log(logger.WARNING, "Would back up: %s to %s", aliasPath, aliasBackupPath)
+		planned(Operation{Action: ActionMove, Path: path, Target: backupPath})
+		return nil
+	}
+
+	err = config.CreateStateDirectory(paths.InitDir)
+	if err != nil {
+		return err
+	}
+
+	err = CreateDirectory(filepath.Dir(backupPath), paths.HomeDir, paths.InitDir)
+	if err != nil {
+		return err
+	}
+
+	err = perform(Operation{Action: ActionMove, Path: path, Target: backupPath}, func() error {
+		return movePath(path, backupPath)
+	})
+	if err != nil {
+		return fmt.Errorf("Couldn't back up %s to %s: %w", aliasPath, aliasBackupPath, err)
+	}
+
+	logger.Log(logger.WARNING, "Backed up: %s to %s", aliasPath, aliasBackupPath)
+	return nil
+}
@@ -0,0 +1,51 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupSamePathTwice(t *testing.T) {
+	homeDir := t.TempDir()
+	initDir := filepath.Join(homeDir, "dotfiles")
+	backupDir := filepath.Join(initDir, ".linksym", "backups", "2024-01-01T00-00-00")
+	writeTestFile(t, filepath.Join(initDir, ".bashrc"), "from dotfiles\n")
+
+	paths := LinkPaths{
+		SourcePath:      filepath.Join(homeDir, ".bashrc"),
+		DestinationPath: filepath.Join(initDir, ".bashrc"),
+		HomeDir:         homeDir,
+		InitDir:         initDir,
+		Conflict:        ConflictBackup,
+		BackupDir:       backupDir,
+	}
+
+	// The file at the symlink path is replaced more than once in the same run,
+	// like a record that's linked again later in the same update
+	for _, content := range []string{"first\n", "second\n", "third\n"} {
+		err := os.Remove(paths.SourcePath)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		writeTestFile(t, paths.SourcePath, content)
+
+		err = paths.Relink()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for backup, want := range map[string]string{
+		".bashrc":   "first\n",
+		".bashrc.1": "second\n",
+		".bashrc.2": "third\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(backupDir, backup))
+		if err != nil {
+			t.Errorf("Backup %s is missing: %v", backup, err)
+		} else if string(data) != want {
+			t.Errorf("Backup %s has %q, want %q", backup, data, want)
+		}
+	}
+}
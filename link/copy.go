@@ -0,0 +1,320 @@
+package link
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/flags"
+	"github.com/SwayKh/linksym/logger"
+)
+
+// Check the copy at the source path against the file at the destination path
+func (paths LinkPaths) copyState() (State, error) {
+	return paths.writtenState(func() ([]byte, error) {
+		return hashFile(paths.DestinationPath)
+	})
+}
+
+// Classify a file that linksym writes to the source path, instead of creating
+// a symlink, by comparing its hash with the hash it should have. The hash of
+// the last file written tells a stale file, which can be replaced, from a file
+// that was changed by hand
+func (paths LinkPaths) writtenState(expectedHash func() ([]byte, error)) (State, error) {
+	source, err := os.Lstat(paths.SourcePath)
+	sourceExists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("Error getting file info of %s: %w", paths.SourcePath, err)
+	}
+
+	_, err = os.Lstat(paths.DestinationPath)
+	destinationExists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("Error getting file info of %s: %w", paths.DestinationPath, err)
+	}
+
+	switch {
+	case !sourceExists && !destinationExists:
+		return StateBothMissing, nil
+	case !destinationExists:
+		return StateRepoMissing, nil
+	case !sourceExists:
+		return StateTargetMissing, nil
+	case !source.Mode().IsRegular():
+		return StateModified, nil
+	}
+
+	expected, err := expectedHash()
+	if err != nil {
+		return 0, err
+	}
+
+	current, err := hashFile(paths.SourcePath)
+	if err != nil {
+		return 0, err
+	}
+
+	if bytes.Equal(current, expected) {
+		return StateUpToDate, nil
+	}
+
+	if hex.EncodeToString(current) == paths.lastWrittenHash() {
+		return StateStale, nil
+	}
+	return StateModified, nil
+}
+
+// Copy the file at the destination path to the source path. A stale copy is
+// replaced right away, a copy that was edited goes through the conflict
+// policy, since its changes would be lost without linksym pull
+func (paths LinkPaths) Copy() error {
+	aliasSourcePath := config.AliasPath(paths.SourcePath, paths.HomeDir, paths.InitDir, true)
+	aliasDestinationPath := config.AliasPath(paths.DestinationPath, paths.HomeDir, paths.InitDir, true)
+
+	if paths.IsDirectory {
+		return fmt.Errorf("Can't copy directory %s, copy records have to be files", aliasDestinationPath)
+	}
+
+	state, err := paths.copyState()
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case StateUpToDate:
+		logger.VerboseLog(logger.INFO, "Already copied: %s", aliasSourcePath)
+		return nil
+
+	case StateRepoMissing, StateBothMissing:
+		return fmt.Errorf("File %s doesn't exist, can't copy it to %s", aliasDestinationPath, aliasSourcePath)
+
+	case StateStale:
+		err = deleteFile(paths.SourcePath, paths.HomeDir, paths.InitDir)
+
+	case StateModified:
+		logger.Log(logger.WARNING, "%s was changed, run linksym pull to keep the changes in %s", aliasSourcePath, aliasDestinationPath)
+		err = paths.resolveConflict(paths.SourcePath)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = CreateDirectory(filepath.Dir(paths.SourcePath), paths.HomeDir, paths.InitDir)
+	if err != nil {
+		return err
+	}
+
+	return paths.copyWritten(paths.DestinationPath, paths.SourcePath)
+}
+
+// Copy the edited file at the source path back into the init directory. If the
+// file in the init directory changed too since it was last copied, it goes
+// through the conflict policy
+func (paths LinkPaths) Pull() error {
+	aliasSourcePath := config.AliasPath(paths.SourcePath, paths.HomeDir, paths.InitDir, true)
+	aliasDestinationPath := config.AliasPath(paths.DestinationPath, paths.HomeDir, paths.InitDir, true)
+
+	state, err := paths.copyState()
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case StateUpToDate:
+		logger.VerboseLog(logger.INFO, "Already up to date: %s", aliasDestinationPath)
+		return nil
+
+	case StateTargetMissing, StateBothMissing:
+		return fmt.Errorf("File %s doesn't exist, nothing to pull", aliasSourcePath)
+
+	case StateStale:
+		logger.Log(logger.WARNING, "%s wasn't changed, %s is newer. Run linksym source to copy it", aliasSourcePath, aliasDestinationPath)
+		return nil
+
+	case StateModified:
+		repoHash, err := hashFile(paths.DestinationPath)
+		if err != nil {
+			return err
+		}
+
+		if hex.EncodeToString(repoHash) == paths.lastWrittenHash() {
+			err = deleteFile(paths.DestinationPath, paths.HomeDir, paths.InitDir)
+		} else {
+			logger.Log(logger.WARNING, "%s and %s were both changed", aliasSourcePath, aliasDestinationPath)
+			err = paths.resolveConflict(paths.DestinationPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err = CreateDirectory(filepath.Dir(paths.DestinationPath), paths.HomeDir, paths.InitDir)
+	if err != nil {
+		return err
+	}
+
+	return paths.copyWritten(paths.SourcePath, paths.DestinationPath)
+}
+
+// Leave the newest copy of the file at the source path, and remove the file in
+// the init directory, along with the hash of the last copy. A missing copy is
+// restored from the init directory, and a stale copy is replaced, so the
+// newer file is never lost. If both files were changed, the copy goes through
+// the conflict policy
+func (paths LinkPaths) unCopy() error {
+	aliasSourcePath := config.AliasPath(paths.SourcePath, paths.HomeDir, paths.InitDir, true)
+	aliasDestinationPath := config.AliasPath(paths.DestinationPath, paths.HomeDir, paths.InitDir, true)
+
+	state, err := paths.copyState()
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case StateBothMissing:
+		return fmt.Errorf("File %s doesn't exist, nothing to restore", aliasDestinationPath)
+
+	case StateRepoMissing:
+		logger.Log(logger.WARNING, "File %s doesn't exist, keeping %s", aliasDestinationPath, aliasSourcePath)
+		return paths.forgetWritten()
+
+	case StateTargetMissing:
+		err = moveFile(paths.DestinationPath, paths.SourcePath, paths.HomeDir, paths.InitDir)
+		if err != nil {
+			return err
+		}
+		return paths.forgetWritten()
+
+	case StateModified:
+		// A copy that was edited while the file in the init directory wasn't is
+		// the newest file, and is kept
+		repoHash, err := hashFile(paths.DestinationPath)
+		if err != nil {
+			return err
+		}
+		if hex.EncodeToString(repoHash) == paths.lastWrittenHash() {
+			break
+		}
+		fallthrough
+
+	case StateStale:
+		err = paths.Copy()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = deleteFile(paths.DestinationPath, paths.HomeDir, paths.InitDir)
+	if err != nil {
+		return err
+	}
+	return paths.forgetWritten()
+}
+
+// Remove the hash of the last file written to the source path, once the record
+// is removed
+func (paths LinkPaths) forgetWritten() error {
+	return deleteFile(paths.writtenHashPath(), paths.HomeDir, paths.InitDir)
+}
+
+// Copy the file at the source path into the init directory, leaving the file
+// in place as the first copy or rendered output of a new copy or template
+// record
+func (paths LinkPaths) CopyToInitDirectory() error {
+	aliasSourcePath := config.AliasPath(paths.SourcePath, paths.HomeDir, paths.InitDir, true)
+
+	if paths.IsDirectory {
+		return fmt.Errorf("Can't add directory %s as a %s record, it has to be a file", aliasSourcePath, paths.Mode)
+	}
+
+	err := paths.resolveConflict(paths.DestinationPath)
+	if err != nil {
+		return err
+	}
+
+	err = CreateDirectory(filepath.Dir(paths.DestinationPath), paths.HomeDir, paths.InitDir)
+	if err != nil {
+		return err
+	}
+
+	return paths.copyWritten(paths.SourcePath, paths.DestinationPath)
+}
+
+// Copy a file of the record, which doesn't exist at the destination anymore,
+// and remember its hash as the last file written
+func (paths LinkPaths) copyWritten(source, destination string) error {
+	aliasSourcePath := config.AliasPath(source, paths.HomeDir, paths.InitDir, true)
+	aliasDestinationPath := config.AliasPath(destination, paths.HomeDir, paths.InitDir, true)
+
+	if *flags.DryRunFlag {
+		logger.Log(logger.INFO, "Would copy: %s to %s", aliasSourcePath, aliasDestinationPath)
+		planned(Operation{Action: ActionWrite, Path: destination})
+		return nil
+	}
+
+	err := perform(Operation{Action: ActionWrite, Path: destination}, func() error {
+		return copyFile(source, destination)
+	})
+	if err != nil {
+		return fmt.Errorf("Couldn't copy %s to %s: %w", aliasSourcePath, aliasDestinationPath, err)
+	}
+	logger.Log(logger.INFO, "Copying: %s to %s", aliasSourcePath, aliasDestinationPath)
+
+	hash, err := hashFile(destination)
+	if err != nil {
+		return err
+	}
+	return paths.saveWrittenHash(hash)
+}
+
+// Path of the file holding the hash of the last file written to the source
+// path. It's kept in the state directory, since it's specific to the machine
+func (paths LinkPaths) writtenHashPath() string {
+	name := sha256.Sum256([]byte(paths.SourcePath))
+	return filepath.Join(config.StateDirectory(paths.InitDir), "written", hex.EncodeToString(name[:8]))
+}
+
+// Get the hash of the last file written to the source path, or an empty string
+// if it was never written on this machine
+func (paths LinkPaths) lastWrittenHash() string {
+	data, err := os.ReadFile(paths.writtenHashPath())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Remember the hash of the file written to the source path
+func (paths LinkPaths) saveWrittenHash(hash []byte) error {
+	hashPath := paths.writtenHashPath()
+
+	err := config.CreateStateDirectory(paths.InitDir)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(hashPath), 0o755)
+	if err != nil {
+		return fmt.Errorf("Failed to create directory %s: %w", filepath.Dir(hashPath), err)
+	}
+
+	err = deleteFile(hashPath, paths.HomeDir, paths.InitDir)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(hashPath, []byte(hex.EncodeToString(hash)+"\n"), 0o644)
+}
+
+// Write a new file, recorded in the journal so it's removed on rollback
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	return perform(Operation{Action: ActionWrite, Path: path}, func() error {
+		return config.WriteFileAtomic(path, data, perm)
+	})
+}
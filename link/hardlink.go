@@ -0,0 +1,110 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/flags"
+	"github.com/SwayKh/linksym/logger"
+)
+
+// Check that the file at the source path is the same file as the one at the
+// destination path, by comparing their inodes instead of a symlink target. A
+// different file at the source path, like one an editor saved over the
+// hardlink, is reported as replaced
+func (paths LinkPaths) hardlinkState() (State, error) {
+	source, err := os.Lstat(paths.SourcePath)
+	sourceExists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("Error getting file info of %s: %w", paths.SourcePath, err)
+	}
+
+	destination, err := os.Lstat(paths.DestinationPath)
+	destinationExists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("Error getting file info of %s: %w", paths.DestinationPath, err)
+	}
+
+	switch {
+	case !sourceExists && !destinationExists:
+		return StateBothMissing, nil
+	case !destinationExists:
+		return StateRepoMissing, nil
+	case !sourceExists:
+		return StateTargetMissing, nil
+	case !os.SameFile(source, destination):
+		return StateReplaced, nil
+	}
+	return StateLinked, nil
+}
+
+// Create a hardlink at path to the existing file at target, which is the
+// destination path when linking a record, or the source path when adding one.
+// Hardlinks can't cross file systems, which is checked first to give a clear
+// error instead of the one from the link system call
+func (paths LinkPaths) hardlink(path, target string) error {
+	aliasPath := config.AliasPath(path, paths.HomeDir, paths.InitDir, true)
+	aliasTarget := config.AliasPath(target, paths.HomeDir, paths.InitDir, true)
+
+	if paths.IsDirectory {
+		return fmt.Errorf("Can't hardlink directory %s, hardlink records have to be files", aliasTarget)
+	}
+
+	err := paths.checkFilesystem()
+	if err != nil {
+		return err
+	}
+
+	if *flags.DryRunFlag {
+		logger.Log(logger.INFO, "Would create hardlink: %s -> %s", aliasPath, aliasTarget)
+		planned(Operation{Action: ActionHardlink, Path: path, Target: target})
+		return nil
+	}
+
+	err = perform(Operation{Action: ActionHardlink, Path: path, Target: target}, func() error {
+		return os.Link(target, path)
+	})
+	if errors.Is(err, syscall.EXDEV) {
+		return paths.crossFilesystemError()
+	} else if err != nil {
+		return fmt.Errorf("Couldn't create hardlink %s: %w", aliasPath, err)
+	}
+
+	logger.Log(logger.SUCCESS, "Creating hardlink...")
+	return nil
+}
+
+// Check that the source and destination paths are on the same file system.
+// Either path may not exist yet, so the closest existing parent directories
+// are compared
+func (paths LinkPaths) checkFilesystem() error {
+	same, err := sameFilesystem(existingParent(paths.SourcePath), existingParent(paths.DestinationPath))
+	if err != nil {
+		return fmt.Errorf("Error checking the file systems of %s and %s: %w", paths.SourcePath, paths.DestinationPath, err)
+	}
+	if !same {
+		return paths.crossFilesystemError()
+	}
+	return nil
+}
+
+func (paths LinkPaths) crossFilesystemError() error {
+	aliasSourcePath := config.AliasPath(paths.SourcePath, paths.HomeDir, paths.InitDir, true)
+	aliasDestinationPath := config.AliasPath(paths.DestinationPath, paths.HomeDir, paths.InitDir, true)
+	return fmt.Errorf("Can't hardlink %s to %s, they are on different file systems. Use a symlink or copy record instead", aliasSourcePath, aliasDestinationPath)
+}
+
+// Get the closest parent directory of path that exists
+func existingParent(path string) string {
+	dir := filepath.Dir(path)
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			return dir
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,425 @@
+package link
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/logger"
+)
+
+// Actions of the operations recorded in the journal
+const (
+	ActionConfig   = "config"
+	ActionHardlink = "hardlink"
+	ActionMkdir    = "mkdir"
+	ActionMove     = "move"
+	ActionRemove   = "remove"
+	ActionSymlink  = "symlink"
+	ActionWrite    = "write"
+)
+
+var ErrUnfinishedJournal = errors.New("A previous linksym run didn't finish. Run linksym recover to replay or revert it")
+
+// A filesystem operation recorded in the journal. Path is the file the
+// operation works on, and Target is where it was moved to, or where the symlink
+// points. Each operation is written to the journal before it's performed, and
+// marked Done after it's finished, so an interrupted operation can be detected
+type Operation struct {
+	Step   int    `json:"step"`
+	Action string `json:"action,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Target string `json:"target,omitempty"`
+	Done   bool   `json:"done,omitempty"`
+}
+
+// Journal of every filesystem operation performed by one linksym run. It lives
+// in the state directory next to the config file, until the run is committed or
+// rolled back, so a journal left behind means linksym was interrupted
+type Journal struct {
+	Directory  string
+	Operations []Operation
+	HomeDir    string
+	InitDir    string
+	file       *os.File
+}
+
+// Journal of the current run, every operation in the link package is recorded
+// in it while it's open
+var activeJournal *Journal
+
+// Get the journal directory of the config file. It's in the directory of the
+// config, which holds the lock too, and not in the init directory written in
+// the config, which is out of date once the dotfiles directory was moved
+func journalDirectory(configPath string) string {
+	return filepath.Join(config.StateDirectory(filepath.Dir(configPath)), "journal")
+}
+
+// Check if a journal was left behind next to the config file
+func HasJournal(configPath string) bool {
+	_, err := os.Stat(filepath.Join(journalDirectory(configPath), "operations.jsonl"))
+	return err == nil
+}
+
+// Open a new journal in the state directory, and record the current contents of
+// the config file in it, so it can be restored on rollback
+func BeginJournal(homeDir, initDir, configPath string) error {
+	if HasJournal(configPath) {
+		return ErrUnfinishedJournal
+	}
+
+	err := config.CreateStateDirectory(filepath.Dir(configPath))
+	if err != nil {
+		return err
+	}
+
+	journal := &Journal{
+		Directory: journalDirectory(configPath),
+		HomeDir:   homeDir,
+		InitDir:   initDir,
+	}
+
+	err = os.MkdirAll(filepath.Join(journal.Directory, "trash"), 0o755)
+	if err != nil {
+		return fmt.Errorf("Failed to create directory %s: %w", journal.Directory, err)
+	}
+
+	journal.file, err = os.OpenFile(filepath.Join(journal.Directory, "operations.jsonl"), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("Failed to create journal: %w", err)
+	}
+
+	activeJournal = journal
+
+	snapshotPath := filepath.Join(journal.Directory, "config.yaml")
+	return perform(Operation{Action: ActionConfig, Path: configPath, Target: snapshotPath}, func() error {
+		return copyFile(configPath, snapshotPath)
+	})
+}
+
+// Close the journal of the current run after everything succeeded. Files that
+// were removed during the run are deleted for good with the journal
+func CommitJournal() error {
+	if activeJournal == nil {
+		return nil
+	}
+	journal := activeJournal
+	activeJournal = nil
+
+	journal.file.Close()
+	return journal.Discard()
+}
+
+// Undo every operation of the current run, in reverse order. If the rollback
+// fails, the journal is kept, so it can be retried with linksym recover
+func RollbackJournal() error {
+	if activeJournal == nil {
+		return nil
+	}
+	journal := activeJournal
+	activeJournal = nil
+
+	journal.file.Close()
+	// The first operation is the config snapshot, anything after it changed
+	// the filesystem
+	if len(journal.Operations) > 1 {
+		logger.Log(logger.WARNING, "Rolling back changes...")
+	}
+
+	err := journal.Revert()
+	if err != nil {
+		return fmt.Errorf("Rollback failed, run linksym recover to retry: %w", err)
+	}
+	return nil
+}
+
+// Load the journal left behind next to the config file by an interrupted run
+func LoadJournal(homeDir, initDir, configPath string) (*Journal, error) {
+	journal := &Journal{
+		Directory: journalDirectory(configPath),
+		HomeDir:   homeDir,
+		InitDir:   initDir,
+	}
+
+	file, err := os.Open(filepath.Join(journal.Directory, "operations.jsonl"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("No unfinished linksym run found, nothing to recover")
+		}
+		return nil, fmt.Errorf("Error opening journal: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var op Operation
+		// The last line may be cut off, if linksym was interrupted while writing it
+		if err := json.Unmarshal(scanner.Bytes(), &op); err != nil {
+			continue
+		}
+
+		if op.Action != "" {
+			journal.Operations = append(journal.Operations, op)
+		} else if op.Done && op.Step > 0 && op.Step <= len(journal.Operations) {
+			journal.Operations[op.Step-1].Done = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Error reading journal: %w", err)
+	}
+
+	return journal, nil
+}
+
+// Undo every operation in the journal in reverse order and remove the journal
+func (j *Journal) Revert() error {
+	for i := len(j.Operations) - 1; i >= 0; i-- {
+		err := j.undo(j.Operations[i])
+		if err != nil {
+			return err
+		}
+	}
+	return j.Discard()
+}
+
+// Finish the operation that was interrupted, keep everything else that was done
+// and remove the journal
+func (j *Journal) Replay() error {
+	for _, op := range j.Operations {
+		if op.Done {
+			continue
+		}
+		err := j.redo(op)
+		if err != nil {
+			return err
+		}
+	}
+	return j.Discard()
+}
+
+// Remove the journal directory, along with the trash and config snapshot
+func (j *Journal) Discard() error {
+	err := os.RemoveAll(j.Directory)
+	if err != nil {
+		return fmt.Errorf("Failed to remove journal %s: %w", j.Directory, err)
+	}
+	return nil
+}
+
+// Path in the trash where the next removed file is moved to
+func (j *Journal) trashPath() string {
+	return filepath.Join(j.Directory, "trash", strconv.Itoa(len(j.Operations)+1))
+}
+
+// Append an operation to the journal and make sure it's on disk before the
+// operation is performed
+func (j *Journal) write(op Operation) error {
+	data, err := json.Marshal(op)
+	if err != nil {
+		return fmt.Errorf("Error marshalling journal operation: %w", err)
+	}
+
+	_, err = j.file.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("Error writing journal: %w", err)
+	}
+	return j.file.Sync()
+}
+
+// Undo an operation. Operations that weren't marked done may not have been
+// performed at all, or only halfway, so the filesystem is checked before
+// undoing anything
+func (j *Journal) undo(op Operation) error {
+	aliasPath := config.AliasPath(op.Path, j.HomeDir, j.InitDir, true)
+	aliasTarget := config.AliasPath(op.Target, j.HomeDir, j.InitDir, true)
+
+	switch op.Action {
+	case ActionConfig:
+		// The config isn't changed until its snapshot is complete
+		if !op.Done {
+			return nil
+		}
+		logger.VerboseLog(logger.WARNING, "Restoring: %s", aliasPath)
+		data, err := os.ReadFile(op.Target)
+		if err != nil {
+			return fmt.Errorf("Error reading config snapshot: %w", err)
+		}
+		return config.WriteFileAtomic(op.Path, data, 0o644)
+
+	case ActionMkdir:
+		// A directory that isn't empty was in use before the run, or still has
+		// files in it that weren't recorded, and is left alone
+		err := os.Remove(op.Path)
+		if err == nil {
+			logger.VerboseLog(logger.WARNING, "Removing directory: %s", aliasPath)
+		}
+		return nil
+
+	case ActionSymlink:
+		info, err := os.Lstat(op.Path)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+		logger.Log(logger.WARNING, "Removing symlink: %s", aliasPath)
+		return os.Remove(op.Path)
+
+	// Only the hardlink itself is removed, the file it links to is kept
+	case ActionHardlink:
+		pathInfo, err := os.Lstat(op.Path)
+		if err != nil {
+			return nil
+		}
+		targetInfo, err := os.Lstat(op.Target)
+		if err != nil || !os.SameFile(pathInfo, targetInfo) {
+			return nil
+		}
+		logger.Log(logger.WARNING, "Removing hardlink: %s", aliasPath)
+		return os.Remove(op.Path)
+
+	// A written file didn't exist before, any file it replaced was removed
+	// first and is restored by undoing that removal
+	case ActionWrite:
+		if !exists(op.Path) {
+			return nil
+		}
+		logger.VerboseLog(logger.WARNING, "Removing: %s", aliasPath)
+		return os.Remove(op.Path)
+
+	case ActionMove, ActionRemove:
+		pathExists := exists(op.Path)
+		switch {
+		case !exists(op.Target):
+			return nil
+
+		// The file was only partly copied to the target
+		case pathExists && !op.Done:
+			return os.RemoveAll(op.Target)
+
+		case pathExists:
+			return fmt.Errorf("Can't restore %s from %s, the file is in the way", aliasPath, aliasTarget)
+		}
+
+		logger.Log(logger.WARNING, "Restoring: %s", aliasPath)
+		return movePath(op.Target, op.Path)
+
+	default:
+		return fmt.Errorf("Unknown journal operation %q", op.Action)
+	}
+}
+
+// Perform an interrupted operation again, cleaning up anything it left behind
+func (j *Journal) redo(op Operation) error {
+	aliasPath := config.AliasPath(op.Path, j.HomeDir, j.InitDir, true)
+
+	switch op.Action {
+	case ActionConfig:
+		return nil
+
+	case ActionMkdir:
+		return os.MkdirAll(op.Path, 0o755)
+
+	case ActionSymlink:
+		if _, err := os.Lstat(op.Path); err == nil {
+			return nil
+		}
+		logger.Log(logger.INFO, "Creating symlink: %s", aliasPath)
+		return os.Symlink(op.Target, op.Path)
+
+	case ActionHardlink:
+		if exists(op.Path) {
+			return nil
+		}
+		logger.Log(logger.INFO, "Creating hardlink: %s", aliasPath)
+		return os.Link(op.Target, op.Path)
+
+	// The contents of written files aren't kept in the journal, so they can't
+	// be written again. Running the command again writes them
+	case ActionWrite:
+		if !exists(op.Path) {
+			logger.Log(logger.WARNING, "Can't write %s again, run the interrupted command again to create it", aliasPath)
+		}
+		return nil
+
+	case ActionMove, ActionRemove:
+		if !exists(op.Path) {
+			return nil
+		}
+		err := os.RemoveAll(op.Target)
+		if err != nil {
+			return err
+		}
+		logger.Log(logger.INFO, "Moving: %s", aliasPath)
+		return movePath(op.Path, op.Target)
+
+	default:
+		return fmt.Errorf("Unknown journal operation %q", op.Action)
+	}
+}
+
+// Record an operation in the active journal and perform it. Without an open
+// journal, the operation is just performed
+func perform(op Operation, action func() error) error {
+	if activeJournal == nil {
+		err := action()
+		if err == nil {
+			emitAction(op, false)
+		}
+		return err
+	}
+
+	op.Step = len(activeJournal.Operations) + 1
+	err := activeJournal.write(op)
+	if err != nil {
+		return err
+	}
+	activeJournal.Operations = append(activeJournal.Operations, op)
+
+	err = action()
+	if err != nil {
+		return err
+	}
+
+	activeJournal.Operations[op.Step-1].Done = true
+	emitAction(op, false)
+	return activeJournal.write(Operation{Step: op.Step, Done: true})
+}
+
+// Tell scripts reading the JSON output about an operation, which was performed
+// or would be performed in a dry run. The config snapshot and the files linksym
+// keeps in its state directory are details of linksym, and aren't reported
+func emitAction(op Operation, dryRun bool) {
+	if op.Action == ActionConfig || inStateDirectory(op.Path) {
+		return
+	}
+	// Removed files are moved to the trash of the journal, which is a detail too
+	if op.Action == ActionRemove {
+		op.Target = ""
+	}
+	logger.Emit(logger.ActionEvent{Action: op.Action, Path: op.Path, Target: op.Target, DryRun: dryRun})
+}
+
+// Report an operation that a dry run would perform
+func planned(op Operation) {
+	emitAction(op, true)
+}
+
+// Check if a path is inside a linksym state directory
+func inStateDirectory(path string) bool {
+	for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if filepath.Base(dir) == config.StateDirName {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if anything exists at the path, without following symlinks
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -0,0 +1,192 @@
+package link
+
+import (
+	"errors"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/flags"
+	"github.com/SwayKh/linksym/logger"
+)
+
+func init() {
+	flags.CreateFlags(flag.NewFlagSet("test", flag.ContinueOnError))
+	logger.Silence()
+}
+
+var errInterrupted = errors.New("interrupted")
+
+// Create a home directory with a few dotfiles, and an init directory with a
+// config file in it. Returns the paths of the records to add
+func setupTree(t *testing.T) (string, string, []LinkPaths) {
+	t.Helper()
+	homeDir := t.TempDir()
+	initDir := filepath.Join(homeDir, "dotfiles")
+
+	writeTestFile(t, filepath.Join(homeDir, ".bashrc"), "alias ll='ls -l'\n")
+	writeTestFile(t, filepath.Join(homeDir, ".config", "git", "config"), "[user]\n")
+	writeTestFile(t, filepath.Join(homeDir, ".config", "nvim", "init.lua"), "vim.o.number = true\n")
+	writeTestFile(t, filepath.Join(homeDir, ".config", "nvim", "lua", "plugins.lua"), "return {}\n")
+	writeTestFile(t, filepath.Join(initDir, ".linksym.yaml"), "version: 1\ninit_directory: ~/dotfiles\nrecords: []\n")
+
+	records := []LinkPaths{}
+	for _, record := range []struct {
+		path  string
+		isDir bool
+	}{
+		{".bashrc", false},
+		{".config/git/config", false},
+		{".config/nvim", true},
+	} {
+		records = append(records, LinkPaths{
+			SourcePath:      filepath.Join(homeDir, record.path),
+			DestinationPath: filepath.Join(initDir, record.path),
+			HomeDir:         homeDir,
+			InitDir:         initDir,
+			IsDirectory:     record.isDir,
+			Conflict:        ConflictFail,
+		})
+	}
+	return homeDir, initDir, records
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Describe every file, directory and symlink under the root, without the
+// linksym state directory, so two trees can be compared
+func snapshotTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	tree := map[string]string{}
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == config.StateDirName {
+			return filepath.SkipDir
+		}
+
+		relPath, _ := filepath.Rel(root, path)
+		switch {
+		case entry.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			tree[relPath] = "symlink to " + target
+		case entry.IsDir():
+			tree[relPath] = "directory"
+		default:
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			tree[relPath] = "file " + string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func compareTrees(t *testing.T, want, got map[string]string) {
+	t.Helper()
+	for path, entry := range want {
+		if got[path] != entry {
+			t.Errorf("%s is %q, want %q", path, got[path], entry)
+		}
+	}
+	for path, entry := range got {
+		if _, ok := want[path]; !ok {
+			t.Errorf("%s is %q, but shouldn't exist", path, entry)
+		}
+	}
+}
+
+// Link the first n records and change the config in a journal, then fail the
+// next operation, as an error or a crash would interrupt the run
+func interruptAfter(t *testing.T, homeDir, initDir string, records []LinkPaths, n int) {
+	t.Helper()
+	configPath := filepath.Join(initDir, ".linksym.yaml")
+	err := BeginJournal(homeDir, initDir, configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, paths := range records[:n] {
+		err := paths.MoveAndLink()
+		if err != nil {
+			t.Fatalf("Linking %s: %v", paths.SourcePath, err)
+		}
+	}
+	writeTestFile(t, configPath, "version: 1\ninit_directory: ~/dotfiles\nrecords: [changed]\n")
+
+	err = perform(Operation{Action: ActionWrite, Path: filepath.Join(homeDir, "interrupted")}, func() error {
+		return errInterrupted
+	})
+	if !errors.Is(err, errInterrupted) {
+		t.Fatalf("Interrupted operation returned %v", err)
+	}
+}
+
+func TestRollbackJournal(t *testing.T) {
+	for n := 0; n <= 3; n++ {
+		homeDir, initDir, records := setupTree(t)
+		before := snapshotTree(t, homeDir)
+
+		interruptAfter(t, homeDir, initDir, records, n)
+		err := RollbackJournal()
+		if err != nil {
+			t.Fatalf("Rollback after %d records: %v", n, err)
+		}
+
+		compareTrees(t, before, snapshotTree(t, homeDir))
+		if HasJournal(filepath.Join(initDir, ".linksym.yaml")) {
+			t.Errorf("Journal is left after rolling back %d records", n)
+		}
+	}
+}
+
+func TestRevertInterruptedJournal(t *testing.T) {
+	for n := 0; n <= 3; n++ {
+		homeDir, initDir, records := setupTree(t)
+		before := snapshotTree(t, homeDir)
+
+		// A killed run leaves the journal behind without rolling it back
+		interruptAfter(t, homeDir, initDir, records, n)
+		activeJournal.file.Close()
+		activeJournal = nil
+		if !HasJournal(filepath.Join(initDir, ".linksym.yaml")) {
+			t.Fatalf("No journal left after interrupting %d records", n)
+		}
+
+		journal, err := LoadJournal(homeDir, initDir, filepath.Join(initDir, ".linksym.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = journal.Revert()
+		if err != nil {
+			t.Fatalf("Revert after %d records: %v", n, err)
+		}
+
+		compareTrees(t, before, snapshotTree(t, homeDir))
+		if HasJournal(filepath.Join(initDir, ".linksym.yaml")) {
+			t.Errorf("Journal is left after reverting %d records", n)
+		}
+	}
+}
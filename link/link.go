@@ -1,12 +1,15 @@
 package link
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"syscall"
 
 	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/flags"
 	"github.com/SwayKh/linksym/logger"
 )
 
@@ -16,28 +19,65 @@ type LinkPaths struct {
 	HomeDir         string
 	InitDir         string
 	IsDirectory     bool
+	Relative        bool
+	Conflict        ConflictPolicy
+	BackupDir       string
+
+	// How the record is put in place, and the values its template is rendered
+	// with
+	Mode string
+	Data TemplateData
 }
 
 // Move the source file to destination and creates a symlink at the source
-// pointing towards the destination path
+// pointing towards the destination path. For hardlink records, nothing needs to
+// be moved, the destination path is created as a hardlink to the source file
 func (paths LinkPaths) MoveAndLink() error {
 	var err error
 	aliasSourcePath := config.AliasPath(paths.SourcePath, paths.HomeDir, paths.InitDir, true)
 	aliasDestinationPath := config.AliasPath(paths.DestinationPath, paths.HomeDir, paths.InitDir, true)
 
+	if paths.Mode == config.ModeHardlink {
+		err = paths.checkFilesystem()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Never replace an existing file in the init directory without going
+	// through the conflict policy
+	err = paths.resolveConflict(paths.DestinationPath)
+	if err != nil {
+		return err
+	}
+
+	if paths.Mode == config.ModeHardlink {
+		err = CreateDirectory(filepath.Dir(paths.DestinationPath), paths.HomeDir, paths.InitDir)
+		if err != nil {
+			return err
+		}
+		return paths.hardlink(paths.DestinationPath, paths.SourcePath)
+	}
+
 	// If path is a directory, Rename it
 	if paths.IsDirectory {
-		// Delete destination, if it exists
-		err = deleteFile(paths.DestinationPath)
+		err = CreateDirectory(filepath.Dir(paths.DestinationPath), paths.HomeDir, paths.InitDir)
 		if err != nil {
 			return err
 		}
 
-		err = os.Rename(paths.SourcePath, paths.DestinationPath)
-		if err != nil {
-			return fmt.Errorf("Couldn't link directory %s to %s: %w", aliasSourcePath, aliasDestinationPath, err)
+		if *flags.DryRunFlag {
+			logger.Log(logger.INFO, "Would move: %s to %s", aliasSourcePath, aliasDestinationPath)
+			planned(Operation{Action: ActionMove, Path: paths.SourcePath, Target: paths.DestinationPath})
+		} else {
+			err = perform(Operation{Action: ActionMove, Path: paths.SourcePath, Target: paths.DestinationPath}, func() error {
+				return movePath(paths.SourcePath, paths.DestinationPath)
+			})
+			if err != nil {
+				return fmt.Errorf("Couldn't link directory %s to %s: %w", aliasSourcePath, aliasDestinationPath, err)
+			}
+			logger.Log(logger.INFO, "Moving: %s to %s", aliasSourcePath, aliasDestinationPath)
 		}
-		logger.Log(logger.INFO, "Moving: %s to %s", aliasSourcePath, aliasDestinationPath)
 	} else {
 		err = moveFile(paths.SourcePath, paths.DestinationPath, paths.HomeDir, paths.InitDir)
 		if err != nil {
@@ -52,11 +92,168 @@ func (paths LinkPaths) MoveAndLink() error {
 	return nil
 }
 
-// Create a symlink of source path at the destination path,
+// Create the symlink at the source path for a file that already lives in the
+// init directory, as when recreating symlinks from records. An existing correct
+// symlink is left alone, anything else at the source path goes through the
+// conflict policy
+func (paths LinkPaths) Relink() error {
+	switch paths.Mode {
+	case config.ModeTemplate:
+		return paths.Render()
+	case config.ModeCopy:
+		return paths.Copy()
+	}
+
+	aliasSourcePath := config.AliasPath(paths.SourcePath, paths.HomeDir, paths.InitDir, true)
+	aliasDestinationPath := config.AliasPath(paths.DestinationPath, paths.HomeDir, paths.InitDir, true)
+
+	state, err := paths.State()
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case StateLinked:
+		logger.VerboseLog(logger.INFO, "Already linked: %s", aliasSourcePath)
+		return nil
+
+	case StateRepoMissing, StateBothMissing:
+		return fmt.Errorf("File %s doesn't exist, can't link %s to it", aliasDestinationPath, aliasSourcePath)
+
+	case StateLinkedElsewhere, StateReplaced:
+		err = paths.resolveConflict(paths.SourcePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = CreateDirectory(filepath.Dir(paths.SourcePath), paths.HomeDir, paths.InitDir)
+	if err != nil {
+		return err
+	}
+
+	return paths.Link()
+}
+
+// Replace a correct symlink with a new one, to switch it between an absolute
+// and a relative symlink. A symlink that's already of the right kind is left
+// alone
+func (paths LinkPaths) Recreate() error {
+	aliasSourcePath := config.AliasPath(paths.SourcePath, paths.HomeDir, paths.InitDir, true)
+
+	state, err := paths.State()
+	if err != nil {
+		return err
+	}
+	if state != StateLinked {
+		return fmt.Errorf("Can't recreate symlink %s, it's %s", aliasSourcePath, state)
+	}
+
+	target, err := os.Readlink(paths.SourcePath)
+	if err != nil {
+		return fmt.Errorf("Error reading symlink %s: %w", aliasSourcePath, err)
+	}
+	if filepath.IsAbs(target) != paths.Relative {
+		logger.VerboseLog(logger.INFO, "Symlink %s is already %s", aliasSourcePath, map[bool]string{true: "relative", false: "absolute"}[paths.Relative])
+		return nil
+	}
+
+	err = deleteFile(paths.SourcePath, paths.HomeDir, paths.InitDir)
+	if err != nil {
+		return err
+	}
+	return paths.Link()
+}
+
+// Move the file in the init directory to a new destination path and point the
+// symlink at the source path to it. A symlink that's missing or points
+// somewhere else is left alone, only the file is moved
+func (paths LinkPaths) Retarget(newDestinationPath string) error {
+	aliasDestinationPath := config.AliasPath(paths.DestinationPath, paths.HomeDir, paths.InitDir, true)
+	aliasNewDestinationPath := config.AliasPath(newDestinationPath, paths.HomeDir, paths.InitDir, true)
+
+	state, err := paths.State()
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case StateRepoMissing, StateBothMissing:
+		return fmt.Errorf("File %s doesn't exist, can't move it to %s", aliasDestinationPath, aliasNewDestinationPath)
+	case StateSymlinkMissing, StateLinkedElsewhere, StateReplaced, StateModified:
+		logger.Log(logger.WARNING, "%s is %s, only moving %s", config.AliasPath(paths.SourcePath, paths.HomeDir, paths.InitDir, true), state, aliasDestinationPath)
+	}
+
+	err = paths.resolveConflict(newDestinationPath)
+	if err != nil {
+		return err
+	}
+
+	err = CreateDirectory(filepath.Dir(newDestinationPath), paths.HomeDir, paths.InitDir)
+	if err != nil {
+		return err
+	}
+
+	if *flags.DryRunFlag {
+		logger.Log(logger.INFO, "Would move: %s to %s", aliasDestinationPath, aliasNewDestinationPath)
+		planned(Operation{Action: ActionMove, Path: paths.DestinationPath, Target: newDestinationPath})
+	} else {
+		err = perform(Operation{Action: ActionMove, Path: paths.DestinationPath, Target: newDestinationPath}, func() error {
+			return movePath(paths.DestinationPath, newDestinationPath)
+		})
+		if err != nil {
+			return fmt.Errorf("Couldn't move %s to %s: %w", aliasDestinationPath, aliasNewDestinationPath, err)
+		}
+		logger.Log(logger.INFO, "Moving: %s to %s", aliasDestinationPath, aliasNewDestinationPath)
+	}
+
+	// A hardlink stays the same file when its destination is moved
+	if state != StateLinked || paths.Mode == config.ModeHardlink {
+		return nil
+	}
+
+	err = deleteFile(paths.SourcePath, paths.HomeDir, paths.InitDir)
+	if err != nil {
+		return err
+	}
+
+	paths.DestinationPath = newDestinationPath
+	return paths.Link()
+}
+
+// Create a symlink of source path at the destination path. With Relative set,
+// the symlink points to the destination relative to the directory of the
+// symlink, so it keeps working when both are reached through another path.
+// Hardlink records get a hardlink instead
 func (paths LinkPaths) Link() error {
+	if paths.Mode == config.ModeHardlink {
+		return paths.hardlink(paths.SourcePath, paths.DestinationPath)
+	}
+
 	aliasDestinationPath := config.AliasPath(paths.DestinationPath, paths.HomeDir, paths.InitDir, true)
 
-	err := os.Symlink(paths.DestinationPath, paths.SourcePath)
+	target := paths.DestinationPath
+	if paths.Relative {
+		relativeTarget, err := filepath.Rel(filepath.Dir(paths.SourcePath), paths.DestinationPath)
+		if err != nil {
+			return fmt.Errorf("Couldn't get the path of %s relative to %s: %w", aliasDestinationPath, filepath.Dir(paths.SourcePath), err)
+		}
+		target = relativeTarget
+	}
+
+	if *flags.DryRunFlag {
+		aliasSourcePath := config.AliasPath(paths.SourcePath, paths.HomeDir, paths.InitDir, true)
+		if paths.Relative {
+			aliasDestinationPath = target
+		}
+		logger.Log(logger.INFO, "Would create symlink: %s -> %s", aliasSourcePath, aliasDestinationPath)
+		planned(Operation{Action: ActionSymlink, Path: paths.SourcePath, Target: target})
+		return nil
+	}
+
+	err := perform(Operation{Action: ActionSymlink, Path: paths.SourcePath, Target: target}, func() error {
+		return os.Symlink(target, paths.SourcePath)
+	})
 	if err != nil {
 		return fmt.Errorf("Couldn't create symlink %s: %w", aliasDestinationPath, err)
 	}
@@ -66,23 +263,58 @@ func (paths LinkPaths) Link() error {
 }
 
 // Remove the symlink file at the source, move the destination file to the
-// original source path. Basically undo-ing the MoveAndLink function
+// original source path. Basically undo-ing the MoveAndLink function. Copy and
+// template records are handled by unCopy and unRender
 func (paths LinkPaths) UnLink() error {
 	aliasSourcePath := config.AliasPath(paths.SourcePath, paths.HomeDir, paths.InitDir, true)
 	aliasDestinationPath := config.AliasPath(paths.DestinationPath, paths.HomeDir, paths.InitDir, true)
 
-	// Delete destination, if it exists
-	err := deleteFile(paths.SourcePath)
+	switch paths.Mode {
+	case config.ModeCopy:
+		return paths.unCopy()
+	case config.ModeTemplate:
+		return paths.unRender()
+	}
+
+	state, err := paths.State()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case state == StateRepoMissing || state == StateBothMissing:
+		return fmt.Errorf("File %s doesn't exist, nothing to restore", aliasDestinationPath)
+
+	// A hardlink is the same file as the destination, so the destination is
+	// removed and the file stays at the source path
+	case state == StateLinked && paths.Mode == config.ModeHardlink:
+		return deleteFile(paths.DestinationPath, paths.HomeDir, paths.InitDir)
+
+	// Only the symlink pointing to the destination can be deleted right away,
+	// anything else at the source path goes through the conflict policy
+	case state == StateLinked:
+		err = deleteFile(paths.SourcePath, paths.HomeDir, paths.InitDir)
+	default:
+		err = paths.resolveConflict(paths.SourcePath)
+	}
 	if err != nil {
 		return err
 	}
 
 	if paths.IsDirectory {
-		err := os.Rename(paths.DestinationPath, paths.SourcePath)
+		if *flags.DryRunFlag {
+			logger.Log(logger.INFO, "Would move: %s to %s", aliasDestinationPath, aliasSourcePath)
+			planned(Operation{Action: ActionMove, Path: paths.DestinationPath, Target: paths.SourcePath})
+			return nil
+		}
+
+		err := perform(Operation{Action: ActionMove, Path: paths.DestinationPath, Target: paths.SourcePath}, func() error {
+			return movePath(paths.DestinationPath, paths.SourcePath)
+		})
 		if err != nil {
-			return fmt.Errorf("Couldn't move directory %s to %s: %w", aliasSourcePath, aliasDestinationPath, err)
+			return fmt.Errorf("Couldn't move directory %s to %s: %w", aliasDestinationPath, aliasSourcePath, err)
 		}
-		logger.Log(logger.INFO, "Moving: %s to %s", aliasSourcePath, aliasDestinationPath)
+		logger.Log(logger.INFO, "Moving: %s to %s", aliasDestinationPath, aliasSourcePath)
 	} else {
 		err := moveFile(paths.DestinationPath, paths.SourcePath, paths.HomeDir, paths.InitDir)
 		if err != nil {
@@ -99,20 +331,59 @@ func moveFile(source, destination, homeDir, initDir string) error {
 	aliasSourcePath := config.AliasPath(source, homeDir, initDir, true)
 	aliasDestinationPath := config.AliasPath(destination, homeDir, initDir, true)
 
+	if *flags.DryRunFlag {
+		err := CreateDirectory(filepath.Dir(destination), homeDir, initDir)
+		if err != nil {
+			return err
+		}
+		logger.Log(logger.INFO, "Would move: %s to %s", aliasSourcePath, aliasDestinationPath)
+		planned(Operation{Action: ActionMove, Path: source, Target: destination})
+		return nil
+	}
+
 	logger.Log(logger.INFO, "Moving: %s to %s", aliasSourcePath, aliasDestinationPath)
 
+	err := CreateDirectory(filepath.Dir(destination), homeDir, initDir)
+	if err != nil {
+		return err
+	}
+
+	return perform(Operation{Action: ActionMove, Path: source, Target: destination}, func() error {
+		return copyAndRemove(source, destination)
+	})
+}
+
+// Copy the contents of the source file to the destination and remove the source
+func copyAndRemove(source, destination string) error {
+	err := copyFile(source, destination)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(source)
+	if err != nil {
+		return fmt.Errorf("Failed to Remove file: %w", err)
+	}
+	return nil
+}
+
+// Create a file at the destination and copy all contents of the source into
+// it, along with its permissions, ownership, timestamps and extended
+// attributes. The copy is synced to disk and compared with the source, so the
+// source can be removed safely afterwards
+func copyFile(source, destination string) error {
 	src, err := os.Open(source)
 	if err != nil {
 		return fmt.Errorf("Failed to open file: %s: %w", source, err)
 	}
 	defer src.Close()
 
-	err = os.MkdirAll(filepath.Dir(destination), 0o755)
+	info, err := src.Stat()
 	if err != nil {
-		return fmt.Errorf("Failed to create directory %s: %w", filepath.Dir(destination), err)
+		return fmt.Errorf("Error getting file info of %s: %w", source, err)
 	}
 
-	dst, err := os.Create(destination)
+	dst, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
 	if err != nil {
 		return fmt.Errorf("Failed to create file %s: %w", destination, err)
 	}
@@ -123,24 +394,127 @@ func moveFile(source, destination, homeDir, initDir string) error {
 		return fmt.Errorf("Failed to copy file %s to %s: %w", source, destination, err)
 	}
 
-	err = deleteFile(source)
+	err = dst.Sync()
+	if err != nil {
+		return fmt.Errorf("Failed to sync file %s: %w", destination, err)
+	}
+
+	// Verify before copying the metadata, since reading the copy would update
+	// its access time again
+	err = verifyCopy(source, destination)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	return copyMetadata(source, destination, info)
 }
 
-// Delete the file at the given path
-func deleteFile(path string) error {
-	file, err := config.GetFileInfo(path)
-	if err != nil {
+// Move a file, directory or symlink by renaming it, falling back to copying
+// when the rename crosses file systems. It isn't recorded in the journal by
+// itself, callers wrap it in an operation, and the journal uses it to move
+// files into its trash and to undo operations
+func movePath(source, destination string) error {
+	err := os.Rename(source, destination)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
 		return err
 	}
 
-	if !file.Exists {
+	info, statErr := os.Lstat(source)
+	if statErr != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(source)
+		if err != nil {
+			return err
+		}
+		err = os.Symlink(target, destination)
+		if err != nil {
+			return err
+		}
+		return os.Remove(source)
+
+	case info.IsDir():
+		return moveDirectory(source, destination)
+
+	default:
+		return copyAndRemove(source, destination)
+	}
+}
+
+// Create a directory and any missing parents. In dry-run mode, only print the
+// directory if it would have been created
+func CreateDirectory(path, homeDir, initDir string) error {
+	if *flags.DryRunFlag {
+		dir, err := config.GetFileInfo(path)
+		if err != nil {
+			return err
+		}
+		if !dir.Exists {
+			logger.Log(logger.INFO, "Would create directory: %s", config.AliasPath(path, homeDir, initDir, true))
+			planned(Operation{Action: ActionMkdir, Path: path})
+		}
 		return nil
 	}
 
+	// Create the missing directories one by one from the top, so each one is
+	// recorded in the journal and can be removed again on rollback
+	missing := []string{}
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		_, err := os.Lstat(dir)
+		if err == nil {
+			break
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("Error getting file info of %s: %w", dir, err)
+		}
+		missing = append(missing, dir)
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		dir := missing[i]
+		err := perform(Operation{Action: ActionMkdir, Path: dir}, func() error {
+			err := os.Mkdir(dir, 0o755)
+			if errors.Is(err, os.ErrExist) {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to create directory %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// Delete the file at the given path. Uses Lstat, so a broken symlink is deleted
+// too, instead of being reported as a missing file. While a journal is open, the
+// file is moved to the journal trash instead, so it can be restored on rollback
+func deleteFile(path, homeDir, initDir string) error {
+	_, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Error getting file info of %s: %w", path, err)
+	}
+
+	if *flags.DryRunFlag {
+		logger.Log(logger.WARNING, "Would remove: %s", config.AliasPath(path, homeDir, initDir, true))
+		planned(Operation{Action: ActionRemove, Path: path})
+		return nil
+	}
+
+	if activeJournal != nil {
+		trashPath := activeJournal.trashPath()
+		return perform(Operation{Action: ActionRemove, Path: path, Target: trashPath}, func() error {
+			return movePath(path, trashPath)
+		})
+	}
+
 	err = os.RemoveAll(path)
 	if err != nil {
 		if os.IsPermission(err) {
@@ -149,5 +523,6 @@ func deleteFile(path string) error {
 			return fmt.Errorf("Failed to Remove file: %w", err)
 		}
 	}
+	emitAction(Operation{Action: ActionRemove, Path: path}, false)
 	return nil
 }
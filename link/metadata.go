@@ -0,0 +1,71 @@
+package link
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Copy the ownership, permissions, extended attributes and timestamps of the
+// source file to the destination. Ownership is set first, since changing it
+// clears the setuid and setgid bits, and timestamps last, since every other
+// change would update them
+func copyMetadata(source, destination string, info os.FileInfo) error {
+	err := copyOwnership(destination, info)
+	if err != nil {
+		return fmt.Errorf("Failed to copy ownership of %s: %w", source, err)
+	}
+
+	err = os.Chmod(destination, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+	if err != nil {
+		return fmt.Errorf("Failed to copy permissions of %s: %w", source, err)
+	}
+
+	err = copyXattrs(source, destination)
+	if err != nil {
+		return fmt.Errorf("Failed to copy extended attributes of %s: %w", source, err)
+	}
+
+	err = os.Chtimes(destination, accessTime(info), info.ModTime())
+	if err != nil {
+		return fmt.Errorf("Failed to copy timestamps of %s: %w", source, err)
+	}
+	return nil
+}
+
+// Check that the destination has the same size and contents as the source,
+// before the source is removed
+func verifyCopy(source, destination string) error {
+	sourceHash, err := hashFile(source)
+	if err != nil {
+		return err
+	}
+
+	destinationHash, err := hashFile(destination)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(sourceHash, destinationHash) {
+		return fmt.Errorf("Copy of %s at %s doesn't match the original", source, destination)
+	}
+	return nil
+}
+
+// Get the SHA-256 hash of the contents of a file
+func hashFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open file: %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read file %s: %w", path, err)
+	}
+	return hash.Sum(nil), nil
+}
@@ -0,0 +1,111 @@
+package link
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Copy the owner and group of the file. Only root can give files away to
+// other users, so a permission error is ignored and the file keeps the owner
+// running linksym
+func copyOwnership(destination string, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	err := os.Lchown(destination, int(stat.Uid), int(stat.Gid))
+	if err != nil && !errors.Is(err, syscall.EPERM) {
+		return err
+	}
+	return nil
+}
+
+// Set the access and modification times of a symlink itself, which os.Chtimes
+// can't do, since it follows the symlink
+func copySymlinkTimes(destination string, info os.FileInfo) error {
+	times := []unix.Timeval{
+		unix.NsecToTimeval(accessTime(info).UnixNano()),
+		unix.NsecToTimeval(info.ModTime().UnixNano()),
+	}
+	err := unix.Lutimes(destination, times)
+	if err != nil && !errors.Is(err, unix.ENOTSUP) {
+		return err
+	}
+	return nil
+}
+
+// Copy every extended attribute of the source file. File systems without
+// extended attributes, and attributes only root is allowed to set, are skipped
+func copyXattrs(source, destination string) error {
+	size, err := unix.Llistxattr(source, nil)
+	if err != nil || size == 0 {
+		if err != nil && !ignoredXattrError(err) {
+			return err
+		}
+		return nil
+	}
+
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(source, buf)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		valueSize, err := unix.Lgetxattr(source, name, nil)
+		if err != nil {
+			return err
+		}
+
+		value := make([]byte, valueSize)
+		valueSize, err = unix.Lgetxattr(source, name, value)
+		if err != nil {
+			return err
+		}
+
+		err = unix.Lsetxattr(destination, name, value[:valueSize], 0)
+		if err != nil && !ignoredXattrError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func ignoredXattrError(err error) bool {
+	return errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) || errors.Is(err, unix.EACCES)
+}
+
+// Check if two existing paths are on the same file system, by comparing the
+// devices they are on
+func sameFilesystem(a, b string) (bool, error) {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+
+	aStat, aOk := aInfo.Sys().(*syscall.Stat_t)
+	bStat, bOk := bInfo.Sys().(*syscall.Stat_t)
+	if !aOk || !bOk {
+		return true, nil
+	}
+	return aStat.Dev == bStat.Dev, nil
+}
+
+// Get the last access time of the file
+func accessTime(info os.FileInfo) time.Time {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(stat.Atim.Unix())
+}
@@ -0,0 +1,36 @@
+//go:build !linux
+
+package link
+
+import (
+	"os"
+	"time"
+)
+
+// Ownership is only copied on Linux
+func copyOwnership(destination string, info os.FileInfo) error {
+	return nil
+}
+
+// The times of symlinks are only copied on Linux, elsewhere symlinks get the
+// time they were copied
+func copySymlinkTimes(destination string, info os.FileInfo) error {
+	return nil
+}
+
+// Extended attributes are only copied on Linux
+func copyXattrs(source, destination string) error {
+	return nil
+}
+
+// Devices are only compared on Linux, elsewhere creating the hardlink fails
+// when the paths are on different file systems
+func sameFilesystem(a, b string) (bool, error) {
+	return true, nil
+}
+
+// The access time isn't available on every platform, so the modification time
+// is used for both
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
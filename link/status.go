@@ -0,0 +1,140 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/SwayKh/linksym/config"
+)
+
+// State of a record on the filesystem, as found by LinkPaths.State()
+type State int
+
+const (
+	StateLinked State = iota
+	StateSymlinkMissing
+	StateLinkedElsewhere
+	StateReplaced
+	StateRepoMissing
+	StateBothMissing
+
+	// States of records that are rendered or copied instead of symlinked
+	StateUpToDate
+	StateTargetMissing
+	StateStale
+	StateModified
+)
+
+func (s State) String() string {
+	switch s {
+	case StateLinked:
+		return "linked"
+	case StateSymlinkMissing:
+		return "symlink missing"
+	case StateLinkedElsewhere:
+		return "points elsewhere"
+	case StateReplaced:
+		return "replaced by file"
+	case StateRepoMissing:
+		return "repo file missing"
+	case StateBothMissing:
+		return "both missing"
+	case StateUpToDate:
+		return "up to date"
+	case StateTargetMissing:
+		return "target missing"
+	case StateStale:
+		return "stale"
+	case StateModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// Name of the state in the JSON output. Unlike String(), these are part of the
+// stable JSON schema and never change
+func (s State) Name() string {
+	switch s {
+	case StateLinked:
+		return "linked"
+	case StateSymlinkMissing:
+		return "symlink_missing"
+	case StateLinkedElsewhere:
+		return "linked_elsewhere"
+	case StateReplaced:
+		return "replaced"
+	case StateRepoMissing:
+		return "repo_missing"
+	case StateBothMissing:
+		return "both_missing"
+	case StateUpToDate:
+		return "up_to_date"
+	case StateTargetMissing:
+		return "target_missing"
+	case StateStale:
+		return "stale"
+	case StateModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// Check if the record is in place and needs no changes
+func (s State) OK() bool {
+	return s == StateLinked || s == StateUpToDate
+}
+
+// Check the symlink at the source path and the file at the destination path,
+// without following or modifying either of them, and classify the record
+func (paths LinkPaths) State() (State, error) {
+	switch paths.Mode {
+	case config.ModeTemplate:
+		return paths.templateState()
+	case config.ModeCopy:
+		return paths.copyState()
+	case config.ModeHardlink:
+		return paths.hardlinkState()
+	}
+
+	source, err := os.Lstat(paths.SourcePath)
+	sourceExists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("Error getting file info of %s: %w", paths.SourcePath, err)
+	}
+
+	_, err = os.Lstat(paths.DestinationPath)
+	destinationExists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("Error getting file info of %s: %w", paths.DestinationPath, err)
+	}
+
+	switch {
+	case !sourceExists && !destinationExists:
+		return StateBothMissing, nil
+	case !destinationExists:
+		return StateRepoMissing, nil
+	case !sourceExists:
+		return StateSymlinkMissing, nil
+	case source.Mode()&os.ModeSymlink == 0:
+		return StateReplaced, nil
+	}
+
+	target, err := os.Readlink(paths.SourcePath)
+	if err != nil {
+		return 0, fmt.Errorf("Error reading symlink %s: %w", paths.SourcePath, err)
+	}
+
+	// Relative symlinks are resolved from the directory containing the symlink
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(paths.SourcePath), target)
+	}
+
+	if filepath.Clean(target) != filepath.Clean(paths.DestinationPath) {
+		return StateLinkedElsewhere, nil
+	}
+	return StateLinked, nil
+}
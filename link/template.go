@@ -0,0 +1,161 @@
+package link
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/SwayKh/linksym/config"
+	"github.com/SwayKh/linksym/flags"
+	"github.com/SwayKh/linksym/logger"
+)
+
+// Values available to templates. Vars holds the variables of .linksym.yaml,
+// and Env the environment of the linksym process
+type TemplateData struct {
+	Hostname string
+	OS       string
+	Arch     string
+	Home     string
+	User     string
+	Vars     map[string]string
+	Env      map[string]string
+}
+
+// Render the template at path. Missing variables are an error, instead of
+// silently rendering as "<no value>"
+func renderTemplate(path string, data TemplateData) ([]byte, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading template %s: %w", path, err)
+	}
+
+	tmpl, err := template.New(filepath.Base(path)).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing template %s: %w", path, err)
+	}
+
+	var output bytes.Buffer
+	err = tmpl.Execute(&output, data)
+	if err != nil {
+		return nil, fmt.Errorf("Error rendering template %s: %w", path, err)
+	}
+	return output.Bytes(), nil
+}
+
+// Check the rendered file at the source path against the output of the
+// template at the destination path
+func (paths LinkPaths) templateState() (State, error) {
+	return paths.writtenState(func() ([]byte, error) {
+		output, err := renderTemplate(paths.DestinationPath, paths.Data)
+		if err != nil {
+			return nil, err
+		}
+		hash := sha256.Sum256(output)
+		return hash[:], nil
+	})
+}
+
+// Render the template at the destination path to the source path. A stale
+// render is replaced right away, a file that was changed by hand or wasn't
+// rendered by linksym goes through the conflict policy
+func (paths LinkPaths) Render() error {
+	aliasSourcePath := config.AliasPath(paths.SourcePath, paths.HomeDir, paths.InitDir, true)
+	aliasDestinationPath := config.AliasPath(paths.DestinationPath, paths.HomeDir, paths.InitDir, true)
+
+	state, err := paths.templateState()
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case StateUpToDate:
+		logger.VerboseLog(logger.INFO, "Already rendered: %s", aliasSourcePath)
+		return nil
+
+	case StateRepoMissing, StateBothMissing:
+		return fmt.Errorf("Template %s doesn't exist, can't render %s", aliasDestinationPath, aliasSourcePath)
+
+	case StateStale:
+		err = deleteFile(paths.SourcePath, paths.HomeDir, paths.InitDir)
+
+	case StateModified:
+		err = paths.resolveConflict(paths.SourcePath)
+	}
+	if err != nil {
+		return err
+	}
+
+	output, err := renderTemplate(paths.DestinationPath, paths.Data)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(paths.DestinationPath)
+	if err != nil {
+		return fmt.Errorf("Error getting file info of %s: %w", aliasDestinationPath, err)
+	}
+
+	err = CreateDirectory(filepath.Dir(paths.SourcePath), paths.HomeDir, paths.InitDir)
+	if err != nil {
+		return err
+	}
+
+	if *flags.DryRunFlag {
+		logger.Log(logger.INFO, "Would render: %s to %s", aliasDestinationPath, aliasSourcePath)
+		planned(Operation{Action: ActionWrite, Path: paths.SourcePath})
+		return nil
+	}
+
+	err = writeFile(paths.SourcePath, output, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256(output)
+	err = paths.saveWrittenHash(hash[:])
+	if err != nil {
+		return err
+	}
+
+	logger.Log(logger.SUCCESS, "Rendering: %s to %s", aliasDestinationPath, aliasSourcePath)
+	return nil
+}
+
+// Leave the rendered file at the source path, and remove the template in the
+// init directory, along with the hash of the last render. A missing or stale
+// render is rendered again first, so the output of the template is never
+// lost, and a render that was changed by hand goes through the conflict policy
+func (paths LinkPaths) unRender() error {
+	aliasSourcePath := config.AliasPath(paths.SourcePath, paths.HomeDir, paths.InitDir, true)
+	aliasDestinationPath := config.AliasPath(paths.DestinationPath, paths.HomeDir, paths.InitDir, true)
+
+	state, err := paths.templateState()
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case StateBothMissing:
+		return fmt.Errorf("Template %s doesn't exist, nothing to restore", aliasDestinationPath)
+
+	case StateRepoMissing:
+		logger.Log(logger.WARNING, "Template %s doesn't exist, keeping %s", aliasDestinationPath, aliasSourcePath)
+		return paths.forgetWritten()
+
+	case StateTargetMissing, StateStale, StateModified:
+		err = paths.Render()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = deleteFile(paths.DestinationPath, paths.HomeDir, paths.InitDir)
+	if err != nil {
+		return err
+	}
+	return paths.forgetWritten()
+}
@@ -0,0 +1,161 @@
+package link
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Move a directory to another file system, where it can't be renamed. The tree
+// is copied and verified before the source is removed, and a partial copy is
+// removed if anything fails. The source is renamed out of the way before it's
+// removed, so a crash while removing it never leaves a half deleted directory
+// at the source path
+func moveDirectory(source, destination string) error {
+	err := copyTree(source, destination)
+	if err == nil {
+		err = verifyTree(source, destination)
+	}
+	if err != nil {
+		os.RemoveAll(destination)
+		return err
+	}
+
+	removing := filepath.Join(filepath.Dir(source), "."+filepath.Base(source)+".linksym-removing")
+	err = os.Rename(source, removing)
+	if err != nil {
+		os.RemoveAll(destination)
+		return fmt.Errorf("Failed to remove directory %s after copying it: %w", source, err)
+	}
+
+	err = os.RemoveAll(removing)
+	if err != nil {
+		return fmt.Errorf("Failed to remove directory %s after copying it: %w", removing, err)
+	}
+	return nil
+}
+
+// Recursively copy a directory, keeping symlinks as symlinks, and copying the
+// permissions, ownership, timestamps and extended attributes of every file and
+// directory. Symlinks keep their ownership, and on Linux their timestamps too
+func copyTree(source, destination string) error {
+	type directory struct {
+		source, destination string
+		info                os.FileInfo
+	}
+	directories := []directory{}
+
+	err := filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destination, relativePath)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.IsDir():
+			// Directories stay writable until their contents are copied, their
+			// real permissions and timestamps are set afterwards
+			err = os.Mkdir(target, 0o700)
+			if err != nil {
+				return fmt.Errorf("Failed to create directory %s: %w", target, err)
+			}
+			directories = append(directories, directory{path, target, info})
+
+		case entry.Type()&fs.ModeSymlink != 0:
+			linkTarget, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("Error reading symlink %s: %w", path, err)
+			}
+			err = os.Symlink(linkTarget, target)
+			if err != nil {
+				return fmt.Errorf("Failed to create symlink %s: %w", target, err)
+			}
+			err = copyOwnership(target, info)
+			if err != nil {
+				return err
+			}
+			return copySymlinkTimes(target, info)
+
+		case entry.Type().IsRegular():
+			return copyFile(path, target)
+
+		default:
+			return fmt.Errorf("Can't copy %s, it isn't a regular file, directory or symlink", path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Set the metadata of the deepest directories first, since copying into a
+	// directory changes its modification time
+	for i := len(directories) - 1; i >= 0; i-- {
+		dir := directories[i]
+		err = copyMetadata(dir.source, dir.destination, dir.info)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check that every file, directory and symlink in the source tree exists in the
+// destination tree with the same type, size, permissions and symlink target.
+// The contents of files are already compared when they are copied
+func verifyTree(source, destination string) error {
+	return filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destination, relativePath)
+
+		sourceInfo, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		targetInfo, err := os.Lstat(target)
+		if err != nil {
+			return fmt.Errorf("Copy of %s is missing: %w", path, err)
+		}
+
+		if sourceInfo.Mode() != targetInfo.Mode() {
+			return fmt.Errorf("Copy of %s at %s has mode %s instead of %s", path, target, targetInfo.Mode(), sourceInfo.Mode())
+		}
+
+		switch {
+		case sourceInfo.Mode()&os.ModeSymlink != 0:
+			sourceLink, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			targetLink, err := os.Readlink(target)
+			if err != nil {
+				return err
+			}
+			if sourceLink != targetLink {
+				return fmt.Errorf("Copy of symlink %s points to %s instead of %s", path, targetLink, sourceLink)
+			}
+
+		case sourceInfo.Mode().IsRegular() && sourceInfo.Size() != targetInfo.Size():
+			return fmt.Errorf("Copy of %s at %s doesn't match the original", path, target)
+		}
+		return nil
+	})
+}
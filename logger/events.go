@@ -0,0 +1,101 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Events are written to stdout with --output json, one JSON object per line.
+// Every object starts with a "type" field naming the event, followed by the
+// fields of the event. The fields are a stable interface for scripts, and are
+// only ever added, never renamed or removed. The schema is documented in the
+// README
+type Event interface {
+	EventType() string
+}
+
+// A change to the filesystem or the config file, or a change that would have
+// been made in a dry run
+type ActionEvent struct {
+	Action string `json:"action"`
+	Path   string `json:"path"`
+	Target string `json:"target,omitempty"`
+	DryRun bool   `json:"dry_run"`
+}
+
+// A record of the config. Change is set when the record was added or removed,
+// State when it was checked against the filesystem, Reason when it was
+// skipped because its conditions don't match the machine, and Git when
+// status --git checked the state of its file in git
+type RecordEvent struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Mode        string   `json:"mode"`
+	Source      string   `json:"source"`
+	Destination string   `json:"destination"`
+	Change      string   `json:"change,omitempty"`
+	State       string   `json:"state,omitempty"`
+	Reason      string   `json:"reason,omitempty"`
+	Git         string   `json:"git,omitempty"`
+}
+
+// A problem found in the config file by linksym validate
+type DiagnosticEvent struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Fix      string `json:"fix,omitempty"`
+}
+
+// An operation in the journal of an interrupted run, listed by linksym recover
+type OperationEvent struct {
+	Step   int    `json:"step"`
+	Action string `json:"action"`
+	Path   string `json:"path"`
+	Target string `json:"target,omitempty"`
+	Done   bool   `json:"done"`
+}
+
+// The last event of every command, telling whether it succeeded
+type ResultEvent struct {
+	Command string      `json:"command"`
+	OK      bool        `json:"ok"`
+	DryRun  bool        `json:"dry_run"`
+	Error   *ErrorEvent `json:"error,omitempty"`
+}
+
+// The error a command failed with. Code is one of a fixed set of codes, which
+// scripts can check instead of the message
+type ErrorEvent struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (ActionEvent) EventType() string     { return "action" }
+func (RecordEvent) EventType() string     { return "record" }
+func (DiagnosticEvent) EventType() string { return "diagnostic" }
+func (OperationEvent) EventType() string  { return "operation" }
+func (ResultEvent) EventType() string     { return "result" }
+
+// Write an event to stdout as a line of JSON. Does nothing unless the output is
+// JSON
+func Emit(event Event) {
+	if !JSONOutput() || silenced {
+		return
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		Log(ERROR, "Error marshalling %s event: %v", event.EventType(), err)
+		return
+	}
+
+	// Put the type before the fields of the event
+	data = bytes.TrimPrefix(data, []byte("{"))
+	fmt.Fprintf(os.Stdout, "{\"type\":%q,%s\n", event.EventType(), data)
+}
@@ -1,6 +1,9 @@
 package logger
 
 import (
+	"io"
+	"os"
+
 	"github.com/SwayKh/linksym/flags"
 	"github.com/fatih/color"
 )
@@ -12,14 +15,45 @@ const (
 	ERROR   = color.FgRed
 )
 
+// Formats of the output, chosen with the --output flag
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// Set by Silence, when the output of linksym is read by a program that only
+// expects its results, like the shell completion scripts
+var silenced bool
+
+// Stop writing logs and events
+func Silence() {
+	silenced = true
+}
+
+// Check if the output is JSON. Logs are written to stderr then, so stdout only
+// has the JSON events
+func JSONOutput() bool {
+	return flags.OutputFlag != nil && *flags.OutputFlag == OutputJSON
+}
+
+func output() io.Writer {
+	if silenced {
+		return io.Discard
+	}
+	if JSONOutput() {
+		return os.Stderr
+	}
+	return color.Output
+}
+
 func VerboseLog(msgColor color.Attribute, msg string, args ...any) {
 	if *flags.VerboseFlag {
 		c := color.New(msgColor, color.Bold)
-		c.Printf(msg+"\n", args...)
+		c.Fprintf(output(), msg+"\n", args...)
 	}
 }
 
 func Log(msgColor color.Attribute, msg string, args ...any) {
 	c := color.New(msgColor, color.Bold)
-	c.Printf(msg+"\n", args...)
+	c.Fprintf(output(), msg+"\n", args...)
 }
@@ -23,7 +23,9 @@ func main() {
 		InitDirectory: "",  // This is set in Run() function in linksym.go
 	}
 
-	if err := App.Run(); err != nil {
+	err = App.Run()
+	App.EmitResult(err)
+	if err != nil {
 		logger.Log(logger.ERROR, "Error: %v", err)
 		os.Exit(1)
 	}